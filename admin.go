@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Runtime-state admin endpoints. "Why isn't my Chromecast showing up" is
+// answered by three questions — is the interface joined and healthy, which
+// rule should have matched, and is a window open — so each gets an
+// endpoint: /interfaces, /rules and /state. All are read-only snapshots.
+
+// ifaceStatus is one interface's runtime status.
+type ifaceStatus struct {
+	Name     string    `json:"name"`
+	Group    string    `json:"group"`
+	Vrf      string    `json:"vrf,omitempty"`
+	Bridge   string    `json:"bridge,omitempty"`
+	Index    int       `json:"index"`
+	MTU      int       `json:"mtu"`
+	Up       bool      `json:"up"`
+	Joined   bool      `json:"joined"`
+	Degraded bool      `json:"degraded"`
+	LastRx   time.Time `json:"last_rx,omitempty"`
+}
+
+// interfacesHandler lists every configured interface with its multicast
+// join status and health.
+func (a *apiServer) interfacesHandler(w http.ResponseWriter, req *http.Request) {
+	cfg := a.r.config()
+	var out []ifaceStatus
+	for gi := range cfg.Groups {
+		g := &cfg.Groups[gi]
+		for _, name := range g.Interfaces {
+			st := ifaceStatus{Name: name, Group: g.Name, Vrf: g.Vrf}
+			a.r.mu.Lock()
+			ifi := a.r.ifaces[name]
+			st.Bridge = a.r.bridgeOf[name]
+			st.LastRx = a.r.lastRx[name]
+			a.r.mu.Unlock()
+			if ifi != nil {
+				st.Index = ifi.Index
+				st.MTU = ifi.MTU
+				st.Up = ifi.Flags&net.FlagUp != 0
+				// Joining happens at socket open; a resolved interface
+				// on a live socket is joined unless the join failed and
+				// the daemon refused to start.
+				st.Joined = true
+			}
+			if ifs := a.r.ifaceStates[name]; ifs != nil {
+				ifs.mu.Lock()
+				st.Degraded = ifs.degraded
+				ifs.mu.Unlock()
+			}
+			out = append(out, st)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// ruleView is one rule as shown by /rules.
+type ruleView struct {
+	Index       int      `json:"index"`
+	Label       string   `json:"label"`
+	Description string   `json:"description,omitempty"`
+	From        string   `json:"from"`
+	To          []string `json:"to"`
+	Summary     string   `json:"summary"`
+	Mirror      string   `json:"mirror,omitempty"`
+	Hits        float64  `json:"hits"`
+}
+
+// rulesHandler dumps the live rule table with hit counts.
+func (a *apiServer) rulesHandler(w http.ResponseWriter, req *http.Request) {
+	cfg := a.r.config()
+	hits := metrics.SumBy("mdns_reflected_total", "rule")
+	out := make([]ruleView, 0, len(cfg.Rules))
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		out = append(out, ruleView{
+			Index:       i,
+			Label:       rule.label(i),
+			Description: rule.Description,
+			From:        rule.From,
+			To:          rule.To,
+			Summary:     describeRule(rule),
+			Mirror:      rule.Mirror,
+			Hits:        hits[rule.label(i)],
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// stateHandler dumps the stateful tables: open windows, dedup size,
+// degraded interfaces.
+func (a *apiServer) stateHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.r.stateSnapshot())
+}
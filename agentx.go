@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AgentX sub-agent (RFC 2741). Many router monitoring deployments are
+// SNMP-only and cannot scrape /metrics, so the core counters are also
+// registered with the host's snmpd as a sub-agent. Only the sliver of the
+// protocol a read-only scalar/column provider needs is implemented here —
+// pulling in an SNMP library for five counters is not worth it, the same
+// trade the metrics registry makes.
+
+// AgentXConfig enables the sub-agent.
+type AgentXConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Address of the AgentX master: a unix socket path or host:port.
+	// Defaults to the conventional /var/agentx/master.
+	Address string `yaml:"address"`
+}
+
+// agentxBase is the registered subtree: the net-snmp playpen
+// (1.3.6.1.4.1.8072.9999.9999) with an arbitrary product subid.
+var agentxBase = []uint32{1, 3, 6, 1, 4, 1, 8072, 9999, 9999, 274}
+
+// AgentX PDU types and varbind value types used below.
+const (
+	axOpen     = 1
+	axClose    = 2
+	axRegister = 3
+	axGet      = 5
+	axGetNext  = 6
+	axPing     = 13
+	axResponse = 18
+
+	axInteger      = 2
+	axCounter64    = 70
+	axTimeTicks    = 67
+	axNoSuchObject = 128
+	axEndOfMib     = 130
+
+	axFlagNetworkByteOrder = 0x10
+)
+
+// mibEntry is one exported sample: an OID under agentxBase and a value.
+type mibEntry struct {
+	oid []uint32
+	typ uint16
+	val uint64
+}
+
+// mibSnapshot renders the current counters as a sorted OID list:
+//
+//	base.1.0          uptime (TimeTicks)
+//	base.2.0          packets reflected, total
+//	base.3.0          packets dropped or suppressed, total
+//	base.4.<ifindex>  packets reflected per interface
+//	base.5.<ifindex>  send errors per interface
+//	base.6.<rule+1>   rule hits
+func (r *Reflector) mibSnapshot() []mibEntry {
+	sub := func(ids ...uint32) []uint32 {
+		return append(append([]uint32{}, agentxBase...), ids...)
+	}
+	dropped := metrics.Sum("mdns_dropped_total") +
+		metrics.Sum("mdns_budget_shed_total") +
+		metrics.Sum("mdns_dedup_suppressed_total") +
+		metrics.Sum("mdns_quiet_suppressed_total")
+	out := []mibEntry{
+		{sub(1, 0), axTimeTicks, uint64(time.Since(r.started).Seconds() * 100)},
+		{sub(2, 0), axCounter64, uint64(metrics.Sum("mdns_reflected_total"))},
+		{sub(3, 0), axCounter64, uint64(dropped)},
+	}
+	byIface := func(col uint32, series map[string]float64) {
+		for name, v := range series {
+			if ifi := r.iface(name); ifi != nil {
+				out = append(out, mibEntry{sub(col, uint32(ifi.Index)), axCounter64, uint64(v)})
+			}
+		}
+	}
+	byIface(4, metrics.SumBy("mdns_reflected_total", "iface"))
+	byIface(5, metrics.SumBy("mdns_send_errors_total", "iface"))
+	cfg := r.config()
+	labelIndex := make(map[string]int, len(cfg.Rules))
+	for i := range cfg.Rules {
+		labelIndex[cfg.Rules[i].label(i)] = i
+	}
+	for rule, v := range metrics.SumBy("mdns_reflected_total", "rule") {
+		// Profile and override hits have no stable numeric identity and
+		// stay HTTP-only.
+		if n, ok := labelIndex[rule]; ok {
+			out = append(out, mibEntry{sub(6, uint32(n)+1), axCounter64, uint64(v)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return oidLess(out[i].oid, out[j].oid) })
+	return out
+}
+
+// startAgentX connects to the master agent and serves the subtree.
+func startAgentX(cfg *Config, r *Reflector) {
+	if !cfg.AgentX.Enabled {
+		return
+	}
+	addr := cfg.AgentX.Address
+	if addr == "" {
+		addr = "/var/agentx/master"
+	}
+	go func() {
+		for {
+			if err := r.serveAgentX(addr); err != nil {
+				log.Printf("agentx: %v; reconnecting in 30s", err)
+			}
+			time.Sleep(30 * time.Second)
+		}
+	}()
+	log.Printf("agentx sub-agent registering %v via %s", agentxBase, addr)
+}
+
+func (r *Reflector) serveAgentX(addr string) error {
+	network := "tcp"
+	if strings.HasPrefix(addr, "/") {
+		network = "unix"
+	}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Open-PDU: timeout, our identifying OID and description.
+	var open bytes.Buffer
+	open.Write([]byte{5, 0, 0, 0}) // 5s timeout
+	axWriteOID(&open, agentxBase)
+	axWriteString(&open, "mdns-reflector")
+	if err := axWritePDU(conn, axOpen, 0, 0, 0, open.Bytes()); err != nil {
+		return err
+	}
+	hdr, payload, err := axReadPDU(conn)
+	if err != nil {
+		return err
+	}
+	sessionID := hdr.sessionID
+	_ = payload
+
+	// Register-PDU for our subtree.
+	var reg bytes.Buffer
+	reg.Write([]byte{5, 127, 0, 0}) // timeout, default priority
+	axWriteOID(&reg, agentxBase)
+	if err := axWritePDU(conn, axRegister, sessionID, 0, 0, reg.Bytes()); err != nil {
+		return err
+	}
+	if _, _, err := axReadPDU(conn); err != nil {
+		return err
+	}
+
+	for {
+		hdr, payload, err := axReadPDU(conn)
+		if err != nil {
+			return err
+		}
+		switch hdr.pduType {
+		case axGet, axGetNext:
+			resp := r.axAnswer(hdr.pduType, payload)
+			if err := axWritePDU(conn, axResponse, hdr.sessionID, hdr.transactionID, hdr.packetID, resp); err != nil {
+				return err
+			}
+		case axPing:
+			empty := make([]byte, 8) // sysUpTime + no error
+			if err := axWritePDU(conn, axResponse, hdr.sessionID, hdr.transactionID, hdr.packetID, empty); err != nil {
+				return err
+			}
+		case axClose:
+			return io.EOF
+		}
+	}
+}
+
+// axAnswer builds a Response payload for a Get or GetNext PDU.
+func (r *Reflector) axAnswer(pduType byte, payload []byte) []byte {
+	mib := r.mibSnapshot()
+	var out bytes.Buffer
+	out.Write(make([]byte, 8)) // sysUpTime, error, index: all zero
+
+	rd := bytes.NewReader(payload)
+	for rd.Len() > 0 {
+		start, ok := axReadOID(rd)
+		if !ok {
+			break
+		}
+		if _, ok := axReadOID(rd); !ok { // range end, unused
+			break
+		}
+		var found *mibEntry
+		for i := range mib {
+			if pduType == axGet && oidEqual(mib[i].oid, start) {
+				found = &mib[i]
+				break
+			}
+			if pduType == axGetNext && oidLess(start, mib[i].oid) {
+				found = &mib[i]
+				break
+			}
+		}
+		switch {
+		case found != nil:
+			axWriteVarbind(&out, found.typ, found.oid, found.val)
+		case pduType == axGet:
+			axWriteVarbind(&out, axNoSuchObject, start, 0)
+		default:
+			axWriteVarbind(&out, axEndOfMib, start, 0)
+		}
+	}
+	return out.Bytes()
+}
+
+// --- wire helpers; everything is sent in network byte order ---
+
+type axHeader struct {
+	pduType                            byte
+	sessionID, transactionID, packetID uint32
+}
+
+func axWritePDU(conn net.Conn, pduType byte, session, txn, packet uint32, payload []byte) error {
+	hdr := make([]byte, 20)
+	hdr[0] = 1 // version
+	hdr[1] = pduType
+	hdr[2] = axFlagNetworkByteOrder
+	binary.BigEndian.PutUint32(hdr[4:], session)
+	binary.BigEndian.PutUint32(hdr[8:], txn)
+	binary.BigEndian.PutUint32(hdr[12:], packet)
+	binary.BigEndian.PutUint32(hdr[16:], uint32(len(payload)))
+	if _, err := conn.Write(hdr); err != nil {
+		return err
+	}
+	_, err := conn.Write(payload)
+	return err
+}
+
+func axReadPDU(conn net.Conn) (axHeader, []byte, error) {
+	raw := make([]byte, 20)
+	if _, err := io.ReadFull(conn, raw); err != nil {
+		return axHeader{}, nil, err
+	}
+	hdr := axHeader{
+		pduType:       raw[1],
+		sessionID:     binary.BigEndian.Uint32(raw[4:]),
+		transactionID: binary.BigEndian.Uint32(raw[8:]),
+		packetID:      binary.BigEndian.Uint32(raw[12:]),
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(raw[16:]))
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return axHeader{}, nil, err
+	}
+	return hdr, payload, nil
+}
+
+func axWriteOID(buf *bytes.Buffer, oid []uint32) {
+	buf.Write([]byte{byte(len(oid)), 0, 0, 0})
+	for _, id := range oid {
+		binary.Write(buf, binary.BigEndian, id)
+	}
+}
+
+func axReadOID(rd *bytes.Reader) ([]uint32, bool) {
+	hdr := make([]byte, 4)
+	if _, err := io.ReadFull(rd, hdr); err != nil {
+		return nil, false
+	}
+	n := int(hdr[0])
+	oid := make([]uint32, 0, n+5)
+	if prefix := hdr[1]; prefix != 0 {
+		oid = append(oid, 1, 3, 6, 1, uint32(prefix))
+	}
+	for i := 0; i < n; i++ {
+		var id uint32
+		if err := binary.Read(rd, binary.BigEndian, &id); err != nil {
+			return nil, false
+		}
+		oid = append(oid, id)
+	}
+	return oid, true
+}
+
+func axWriteString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.WriteString(s)
+	for pad := (4 - len(s)%4) % 4; pad > 0; pad-- {
+		buf.WriteByte(0)
+	}
+}
+
+func axWriteVarbind(buf *bytes.Buffer, typ uint16, oid []uint32, val uint64) {
+	binary.Write(buf, binary.BigEndian, typ)
+	buf.Write([]byte{0, 0})
+	axWriteOID(buf, oid)
+	switch typ {
+	case axCounter64:
+		binary.Write(buf, binary.BigEndian, val)
+	case axInteger, axTimeTicks:
+		binary.Write(buf, binary.BigEndian, uint32(val))
+	}
+}
+
+func oidLess(a, b []uint32) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func oidEqual(a, b []uint32) bool {
+	return !oidLess(a, b) && !oidLess(b, a)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Rate-of-new-records anomaly detector. A healthy device announces a
+// handful of record names, ever; a compromised one enumerating or
+// spoofing services mints hundreds of brand-new names in minutes, and a
+// reflector happily poisons every segment's caches with them. The
+// detector counts names never seen before per source, and a source that
+// mints them faster than the threshold is quarantined: its packets are
+// dropped until the quarantine lapses.
+
+// AnomalyConfig tunes the detector. It is on by default; a threshold of
+// -1 disables it.
+type AnomalyConfig struct {
+	// NewNamesPerMinute is the per-source rate above which the source is
+	// quarantined. Default 30, -1 disables.
+	NewNamesPerMinute int `yaml:"new_names_per_minute"`
+	// QuarantineSeconds is how long a flagged source stays blocked.
+	// Default 300.
+	QuarantineSeconds int `yaml:"quarantine_seconds"`
+}
+
+// compile applies defaults.
+func (c *AnomalyConfig) compile() {
+	if c.NewNamesPerMinute == 0 {
+		c.NewNamesPerMinute = 30
+	}
+	if c.QuarantineSeconds <= 0 {
+		c.QuarantineSeconds = 300
+	}
+}
+
+// anomalySeenCap bounds the known-names set; when full it resets, which
+// momentarily re-counts old names as new but keeps memory flat.
+const anomalySeenCap = 65536
+
+type anomalyDetector struct {
+	r  *Reflector
+	mu sync.Mutex
+	// seen is every record owner name observed, lowercased.
+	seen map[string]bool
+	// minted counts new names per source IP within the current window.
+	minted      map[string]int
+	windowStart time.Time
+	// quarantined maps source IP to release time.
+	quarantined map[string]time.Time
+}
+
+func newAnomalyDetector(r *Reflector) *anomalyDetector {
+	return &anomalyDetector{
+		r:           r,
+		seen:        make(map[string]bool),
+		minted:      make(map[string]int),
+		quarantined: make(map[string]time.Time),
+	}
+}
+
+// observe folds a response's record names into the per-source new-name
+// rate and quarantines sources past the threshold.
+func (a *anomalyDetector) observe(pkt *packet, srcIface string) {
+	cfg := a.r.config().Anomaly
+	if cfg.NewNamesPerMinute < 0 || !pkt.msg.Response {
+		return
+	}
+	now := a.r.clk.Now()
+	src := pkt.src.IP.String()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if now.Sub(a.windowStart) >= time.Minute {
+		a.windowStart = now
+		a.minted = make(map[string]int)
+	}
+	for _, rr := range pkt.msg.Answer {
+		if rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		name := strings.ToLower(rr.Header().Name)
+		if a.seen[name] {
+			continue
+		}
+		if len(a.seen) >= anomalySeenCap {
+			a.seen = make(map[string]bool)
+		}
+		a.seen[name] = true
+		a.minted[src]++
+	}
+	if a.minted[src] <= cfg.NewNamesPerMinute {
+		return
+	}
+	if _, already := a.quarantined[src]; already {
+		return
+	}
+	a.quarantined[src] = now.Add(time.Duration(cfg.QuarantineSeconds) * time.Second)
+	metrics.Inc("mdns_quarantines_total", Labels{"iface": srcIface})
+	log.Printf("anomaly: quarantining %s on %s: %d new record names within a minute",
+		src, srcIface, a.minted[src])
+	a.r.events.publish(Event{
+		Type:    "quarantine",
+		Iface:   srcIface,
+		SrcIP:   src,
+		Summary: "new-record rate exceeded threshold",
+	})
+}
+
+// blocked reports whether a source is currently quarantined.
+func (a *anomalyDetector) blocked(ip net.IP) bool {
+	src := ip.String()
+	now := a.r.clk.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	until, ok := a.quarantined[src]
+	if !ok {
+		return false
+	}
+	if now.After(until) {
+		delete(a.quarantined, src)
+		log.Printf("anomaly: quarantine on %s lapsed", src)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// apiServer is the optional HTTP listener for metrics and runtime
+// inspection, enabled by setting api.listen in the config.
+type apiServer struct {
+	r   *Reflector
+	mux *http.ServeMux
+}
+
+// startAPI launches the HTTP listener if one is configured.
+func startAPI(cfg *Config, r *Reflector) *apiServer {
+	if cfg.API.Listen == "" {
+		return nil
+	}
+	a := &apiServer{r: r, mux: http.NewServeMux()}
+	a.mux.Handle("/metrics", metrics)
+	a.mux.Handle("/slo", r.slo)
+	a.mux.HandleFunc("/events", a.eventsHandler)
+	a.mux.HandleFunc("/interfaces/attach", a.attachHandler)
+	a.mux.HandleFunc("/interfaces/detach", a.detachHandler)
+	a.mux.HandleFunc("/diagnostics/snooping", a.snoopingHandler)
+	a.mux.HandleFunc("/shadow/load", a.shadowLoadHandler)
+	a.mux.HandleFunc("/shadow/report", a.shadowReportHandler)
+	a.mux.HandleFunc("/flush/", a.flushHandler)
+	a.mux.HandleFunc("/names", a.namesHandler)
+	a.mux.HandleFunc("/suggest", a.suggestHandler)
+	a.mux.HandleFunc("/reload", a.reloadHandler)
+	a.mux.HandleFunc("/reload/confirm", a.confirmHandler)
+	a.mux.HandleFunc("/history", a.historyHandler)
+	a.mux.HandleFunc("/pause", a.pauseHandler)
+	a.mux.HandleFunc("/services", a.servicesHandler)
+	a.mux.HandleFunc("/interfaces", a.interfacesHandler)
+	a.mux.HandleFunc("/rules", a.rulesHandler)
+	a.mux.HandleFunc("/state", a.stateHandler)
+	a.mux.HandleFunc("/capture", a.captureHandler)
+	a.mux.HandleFunc("/inventory", a.inventoryHandler)
+	a.mux.HandleFunc("/records/history", a.recordsHandler)
+	a.mux.HandleFunc("/learning", a.learningHandler)
+	a.mux.HandleFunc("/config", a.configHandler)
+	tlsConf, err := buildTLSConfig(&cfg.API.TLS)
+	if err != nil {
+		log.Printf("api listener: %v", err)
+		return nil
+	}
+	srv := &http.Server{Addr: cfg.API.Listen, Handler: a.mux, TLSConfig: tlsConf}
+	go func() {
+		var err error
+		if tlsConf != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
+			log.Printf("api listener: %v", err)
+		}
+	}()
+	scheme := "http"
+	if tlsConf != nil {
+		scheme = "https"
+	}
+	log.Printf("api listening on %s (%s)", cfg.API.Listen, scheme)
+	return a
+}
+
+// namesHandler lists or assigns friendly device labels:
+// GET /names, or POST /names {"key": "aa:bb:cc:dd:ee:ff", "label": "Kitchen HomePod"}.
+// The key is a MAC address or a service instance name; an empty label
+// removes the assignment.
+func (a *apiServer) namesHandler(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deviceNames.snapshot())
+	case http.MethodPost:
+		var body struct {
+			Key   string `json:"key"`
+			Label string `json:"label"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Key == "" {
+			http.Error(w, "key required", http.StatusBadRequest)
+			return
+		}
+		if err := deviceNames.assign(body.Key, body.Label); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "GET or POST required", http.StatusMethodNotAllowed)
+	}
+}
+
+// flushHandler clears one learned-state table by name:
+// POST /flush/inventory, /flush/hosts, /flush/dedup or /flush/queries.
+// Essential when testing device changes without waiting for TTL expiry.
+func (a *apiServer) flushHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	what := strings.TrimPrefix(req.URL.Path, "/flush/")
+	switch what {
+	case "inventory":
+		a.r.inv.flush()
+	case "hosts":
+		localHosts.flush()
+	case "dedup":
+		a.r.dedup.flush()
+	case "queries":
+		a.r.flushQueries()
+	case "cache":
+		a.r.rcache.flush()
+	default:
+		http.Error(w, "unknown table "+what, http.StatusNotFound)
+		return
+	}
+	log.Printf("api: flushed %s", what)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// attachHandler adds an interface to a group at runtime:
+// POST /interfaces/attach {"group": "users", "iface": "vlan.30"}
+func (a *apiServer) attachHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Group string `json:"group"`
+		Iface string `json:"iface"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.r.AttachInterface(body.Group, body.Iface); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// detachHandler removes an interface from its group at runtime:
+// POST /interfaces/detach {"iface": "vlan.30"}
+func (a *apiServer) detachHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Iface string `json:"iface"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.r.DetachInterface(body.Iface); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Bridge awareness. If two configured interfaces are ports of the same
+// Linux bridge, reflecting onto both delivers every packet twice to the
+// bridged segment. Membership is read from sysfs; destinations that share
+// a bridge are deduplicated at send time.
+
+// bridgeMaster returns the bridge an interface is a port of, or "".
+func bridgeMaster(iface string) string {
+	link, err := os.Readlink(filepath.Join("/sys/class/net", iface, "brport", "bridge"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(link)
+}
+
+// buildBridgeMap records the bridge of every attached interface and warns
+// about configured interfaces that share one; the caller holds r.mu.
+func (r *Reflector) buildBridgeMap() {
+	byBridge := make(map[string]string)
+	for name := range r.ifaces {
+		br := bridgeMaster(name)
+		r.bridgeOf[name] = br
+		if br == "" {
+			continue
+		}
+		if other, ok := byBridge[br]; ok {
+			log.Printf("WARNING: interfaces %s and %s are both ports of bridge %s; duplicate destinations on it will be suppressed", other, name, br)
+		} else {
+			byBridge[br] = name
+		}
+	}
+}
+
+// dedupByBridge filters a destination list so at most one interface per
+// bridge remains. Interfaces outside any bridge pass through untouched.
+func (r *Reflector) dedupByBridge(dsts []string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := make(map[string]bool)
+	out := dsts[:0]
+	for _, name := range dsts {
+		if br := r.bridgeOf[name]; br != "" {
+			if seen[br] {
+				metrics.Inc("mdns_bridge_dedup_total", Labels{"bridge": br})
+				continue
+			}
+			seen[br] = true
+		}
+		out = append(out, name)
+	}
+	return out
+}
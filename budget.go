@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Budget caps reflected traffic into a destination group, in packets per
+// second and/or kilobits per second. When the budget is exhausted,
+// announcements are shed before queries: a fifth of the budget is reserved
+// for queries so discovery keeps limping along while bulk responses are
+// dropped.
+type Budget struct {
+	PPS  float64 `yaml:"pps"`
+	Kbps float64 `yaml:"kbps"`
+}
+
+func (b *Budget) compile() error {
+	if b.PPS < 0 || b.Kbps < 0 {
+		return fmt.Errorf("budget values must be positive")
+	}
+	return nil
+}
+
+func (b *Budget) enabled() bool {
+	return b.PPS > 0 || b.Kbps > 0
+}
+
+// queryReserveFraction is the share of a group's budget that only queries
+// may consume once the bucket runs low.
+const queryReserveFraction = 0.2
+
+// budgetState is the runtime token bucket for one destination group.
+type budgetState struct {
+	budget *Budget
+
+	mu       sync.Mutex
+	pkts     float64
+	bytes    float64
+	lastFill time.Time
+}
+
+func newBudgetState(b *Budget) *budgetState {
+	return &budgetState{
+		budget:   b,
+		pkts:     b.PPS,
+		bytes:    b.Kbps * 125, // kbit/s -> bytes over a 1s burst window
+		lastFill: time.Now(),
+	}
+}
+
+// allow consumes budget for one packet of the given size, shedding
+// announcements first. It reports whether the packet may be sent.
+func (s *budgetState) allow(size int, isQuery bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(s.lastFill).Seconds()
+	s.lastFill = now
+
+	reserve := 0.0
+	if !isQuery {
+		reserve = queryReserveFraction
+	}
+	if s.budget.PPS > 0 {
+		s.pkts += elapsed * s.budget.PPS
+		if s.pkts > s.budget.PPS {
+			s.pkts = s.budget.PPS
+		}
+		if s.pkts < 1+reserve*s.budget.PPS {
+			return false
+		}
+	}
+	if s.budget.Kbps > 0 {
+		capacity := s.budget.Kbps * 125
+		s.bytes += elapsed * capacity
+		if s.bytes > capacity {
+			s.bytes = capacity
+		}
+		if s.bytes < float64(size)+reserve*capacity {
+			return false
+		}
+	}
+	if s.budget.PPS > 0 {
+		s.pkts--
+	}
+	if s.budget.Kbps > 0 {
+		s.bytes -= float64(size)
+	}
+	return true
+}
+
+// saturation is 1.0 when the bucket is empty and 0.0 when full, for the
+// mdns_budget_saturation gauge.
+func (s *budgetState) saturation() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.budget.PPS > 0 {
+		return 1 - s.pkts/s.budget.PPS
+	}
+	if s.budget.Kbps > 0 {
+		return 1 - s.bytes/(s.budget.Kbps*125)
+	}
+	return 0
+}
+
+// budgetAllows checks the destination group's budget for one send and
+// records shedding metrics. Groups without a budget always pass.
+func (r *Reflector) budgetAllows(dstIface string, size int, isQuery bool) bool {
+	g := r.groupOfIface(dstIface)
+	if g == nil || !g.Budget.enabled() {
+		return true
+	}
+	r.mu.Lock()
+	st, ok := r.budgets[g.Name]
+	if !ok {
+		st = newBudgetState(&g.Budget)
+		r.budgets[g.Name] = st
+	}
+	r.mu.Unlock()
+	ok = st.allow(size, isQuery)
+	metrics.Set("mdns_budget_saturation", Labels{"group": g.Name}, st.saturation())
+	if !ok {
+		kind := "announcement"
+		if isQuery {
+			kind = "query"
+		}
+		metrics.Inc("mdns_budget_shed_total", Labels{"group": g.Name, "kind": kind})
+	}
+	return ok
+}
+
+// groupOfIface resolves the group an interface currently belongs to.
+func (r *Reflector) groupOfIface(name string) *Group {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ifi, ok := r.ifaces[name]
+	if !ok {
+		return nil
+	}
+	return r.ifaceIndex[ifi.Index]
+}
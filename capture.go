@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Live packet capture. Running tcpdump on the router means root and a
+// shell; the reflector already decodes every packet, so /capture streams
+// the decoded summaries to any HTTP client instead. Records are only
+// built while someone is attached — an idle tap costs one atomic load
+// per packet — and a slow client loses records rather than stalling the
+// packet path, same as the event bus.
+
+// captureRecord is one received packet as seen by the capture tap.
+type captureRecord struct {
+	Time     time.Time `json:"time"`
+	Iface    string    `json:"iface"`
+	SrcIP    string    `json:"src_ip"`
+	SrcPort  int       `json:"src_port"`
+	Class    string    `json:"class"`
+	Services []string  `json:"services,omitempty"`
+	Summary  string    `json:"summary"`
+	Bytes    int       `json:"bytes"`
+}
+
+type captureBus struct {
+	mu   sync.Mutex
+	subs map[chan captureRecord]struct{}
+	n    atomic.Int32
+}
+
+func newCaptureBus() *captureBus {
+	return &captureBus{subs: make(map[chan captureRecord]struct{})}
+}
+
+// active reports whether anyone is attached; the packet path checks this
+// before building a record.
+func (b *captureBus) active() bool {
+	return b.n.Load() > 0
+}
+
+func (b *captureBus) subscribe() (chan captureRecord, func()) {
+	ch := make(chan captureRecord, 256)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	b.n.Add(1)
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+		b.n.Add(-1)
+	}
+}
+
+// publish fans a record out, dropping it for subscribers whose buffer is
+// full.
+func (b *captureBus) publish(rec captureRecord) {
+	b.mu.Lock()
+	for ch := range b.subs {
+		select {
+		case ch <- rec:
+		default:
+		}
+	}
+	b.mu.Unlock()
+}
+
+// tapPacket builds and publishes a capture record for one received
+// packet; the caller has already checked active().
+func (r *Reflector) tapPacket(pkt *packet, srcIface string) {
+	r.capture.publish(captureRecord{
+		Time:     r.clk.Now(),
+		Iface:    srcIface,
+		SrcIP:    pkt.src.IP.String(),
+		SrcPort:  pkt.src.Port,
+		Class:    pkt.class(),
+		Services: pkt.services(),
+		Summary:  getMsgSummary(pkt.msg),
+		Bytes:    len(pkt.payload),
+	})
+}
+
+// captureHandler streams capture records as ndjson (or SSE when the
+// client asks for text/event-stream), filtered by ?iface=, ?service=
+// and ?type=.
+func (a *apiServer) captureHandler(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	sse := strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+
+	wantIface := req.URL.Query().Get("iface")
+	wantService := normalizeService(req.URL.Query().Get("service"))
+	wantType := req.URL.Query().Get("type")
+
+	privacy := a.r.config().Privacy.Events
+	ch, cancel := a.r.capture.subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case rec := <-ch:
+			if wantIface != "" && rec.Iface != wantIface {
+				continue
+			}
+			if wantType != "" && rec.Class != wantType {
+				continue
+			}
+			if wantService != "" {
+				hit := false
+				for _, s := range rec.Services {
+					if s == wantService {
+						hit = true
+						break
+					}
+				}
+				if !hit {
+					continue
+				}
+			}
+			rec.SrcIP = scrubIP(rec.SrcIP, privacy)
+			rec.Summary = scrubText(rec.Summary, privacy)
+			line, err := json.Marshal(rec)
+			if err != nil {
+				continue
+			}
+			if sse {
+				fmt.Fprintf(w, "data: %s\n\n", line)
+			} else {
+				fmt.Fprintf(w, "%s\n", line)
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ClientOverride pins a policy to one device, identified by IP or MAC,
+// evaluated before the group rules. Policy "deny" drops the packet
+// unconditionally; policy "allow" forwards it without filter checks, either
+// to the groups in To or, when To is empty, to the destinations of every
+// rule matching the client's group.
+type ClientOverride struct {
+	IP     string   `yaml:"ip"`
+	MAC    string   `yaml:"mac"`
+	Policy string   `yaml:"policy"`
+	To     []string `yaml:"to"`
+}
+
+func (c *ClientOverride) compile(groups map[string]bool) error {
+	if c.IP == "" && c.MAC == "" {
+		return fmt.Errorf("client override needs an ip or mac")
+	}
+	if c.IP != "" && net.ParseIP(c.IP) == nil {
+		return fmt.Errorf("client override: bad ip %q", c.IP)
+	}
+	if c.MAC != "" {
+		hw, err := net.ParseMAC(c.MAC)
+		if err != nil {
+			return fmt.Errorf("client override: bad mac %q", c.MAC)
+		}
+		c.MAC = hw.String()
+	}
+	if c.Policy != "allow" && c.Policy != "deny" {
+		return fmt.Errorf("client override: policy must be allow or deny, got %q", c.Policy)
+	}
+	for _, to := range c.To {
+		if !groups[to] {
+			return fmt.Errorf("client override: unknown group %q in to", to)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the override applies to the packet's source.
+// MAC matching resolves the source IP through the kernel neighbor table,
+// so it keeps working when the device's DHCP lease changes.
+func (c *ClientOverride) matches(srcIP net.IP) bool {
+	if c.IP != "" {
+		return c.IP == srcIP.String()
+	}
+	mac := lookupMAC(srcIP)
+	return mac != "" && strings.EqualFold(mac, c.MAC)
+}
+
+// clientOverride returns the first override matching the source, or nil.
+func (c *Config) clientOverride(srcIP net.IP) *ClientOverride {
+	for i := range c.Clients {
+		if c.Clients[i].matches(srcIP) {
+			return &c.Clients[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import "time"
+
+// clock abstracts wall time for the stateful pieces — query windows,
+// dedup horizons, quiet hours — so tests can advance it deterministically
+// instead of sleeping.
+type clock interface {
+	Now() time.Time
+}
+
+// realClock is the production clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
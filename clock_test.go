@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// fakeClock is a hand-advanced clock for deterministic tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func testQuery(t *testing.T, name string) *packet {
+	t.Helper()
+	wire := packQuery(t, name)
+	pkt, err := parsePacket(wire, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1)}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkt
+}
+
+func TestDedupHorizonDeterministic(t *testing.T) {
+	cfg := &QueryDedupConfig{
+		DefaultMS: 0,
+		Services:  map[string]int{"_googlecast._tcp": 2000},
+	}
+	if err := cfg.compile(); err != nil {
+		t.Fatal(err)
+	}
+	clk := &fakeClock{t: time.Unix(1700000000, 0)}
+	d := newDedupTable(cfg)
+	d.clk = clk
+
+	pkt := testQuery(t, "_googlecast._tcp.local.")
+	if d.duplicate(pkt, "eth0") {
+		t.Fatal("first query must not be a duplicate")
+	}
+	clk.advance(500 * time.Millisecond)
+	if !d.duplicate(pkt, "eth0") {
+		t.Fatal("repeat inside the horizon must be suppressed")
+	}
+	clk.advance(3 * time.Second)
+	if d.duplicate(pkt, "eth0") {
+		t.Fatal("repeat after the horizon must pass")
+	}
+	// A service without a horizon is never suppressed.
+	rare := testQuery(t, "_ssh._tcp.local.")
+	if d.duplicate(rare, "eth0") || d.duplicate(rare, "eth0") {
+		t.Fatal("service without a horizon must never be suppressed")
+	}
+	// A client re-querying faster than the horizon is suppressed at most
+	// once per horizon: suppressed repeats must not slide the timestamp.
+	clk.advance(1500 * time.Millisecond)
+	if !d.duplicate(pkt, "eth0") {
+		t.Fatal("repeat inside the horizon must be suppressed")
+	}
+	clk.advance(1500 * time.Millisecond)
+	if d.duplicate(pkt, "eth0") {
+		t.Fatal("query a full horizon after the last reflection must pass")
+	}
+}
+
+func TestQuietHoursWrapMidnight(t *testing.T) {
+	q := &QuietHoursConfig{From: "23:00", To: "07:00"}
+	if err := q.compile(); err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		hour int
+		want bool
+	}{{22, false}, {23, true}, {2, true}, {6, true}, {7, false}, {12, false}}
+	for _, c := range cases {
+		if got := q.active(day.Add(time.Duration(c.hour) * time.Hour)); got != c.want {
+			t.Errorf("active at %02d:00 = %v, want %v", c.hour, got, c.want)
+		}
+	}
+}
+
+func TestWindowExpiryInSnapshot(t *testing.T) {
+	clk := &fakeClock{t: time.Unix(1700000000, 0)}
+	r := &Reflector{
+		recentQueries: make(map[string]*recentQuery),
+		ifaceStates:   make(map[string]*ifaceState),
+		queryWindow:   5 * time.Second,
+		clk:           clk,
+		dedup:         newDedupTable(&QueryDedupConfig{}),
+	}
+	pkt := testQuery(t, "_airplay._tcp.local.")
+	r.openWindow([]string{"vlan.20"}, "vlan.30", &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1)}, pkt)
+
+	st := r.stateSnapshot()
+	if len(st.Windows) != 1 || !st.Windows[0].Open {
+		t.Fatalf("expected one open window, got %+v", st.Windows)
+	}
+	clk.advance(6 * time.Second)
+	st = r.stateSnapshot()
+	if st.Windows[0].Open {
+		t.Fatal("window must expire after the query window elapses")
+	}
+}
+
+func TestMatchWindowPerQuestion(t *testing.T) {
+	clk := &fakeClock{t: time.Unix(1700000000, 0)}
+	r := &Reflector{
+		recentQueries: make(map[string]*recentQuery),
+		ifaceStates:   make(map[string]*ifaceState),
+		queryWindow:   5 * time.Second,
+		clk:           clk,
+		dedup:         newDedupTable(&QueryDedupConfig{}),
+	}
+	pkt := testQuery(t, "_airplay._tcp.local.")
+	r.openWindow([]string{"vlan.20"}, "vlan.30", &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1)}, pkt)
+
+	resp := new(dns.Msg)
+	resp.Response = true
+	rr, err := dns.NewRR("_airplay._tcp.local. 120 IN PTR tv._airplay._tcp.local.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Answer = []dns.RR{rr}
+	raw, err := resp.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpkt, err := parsePacket(raw, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 9)}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replyTo, _ := r.matchWindow(rpkt, "vlan.20")
+	if len(replyTo) != 1 || replyTo[0] != "vlan.30" {
+		t.Fatalf("matching answer should reflect back, got %v", replyTo)
+	}
+
+	// A response to a question nobody asked stays put.
+	other, err := dns.NewRR("_ipp._tcp.local. 120 IN PTR printer._ipp._tcp.local.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Answer = []dns.RR{other}
+	raw, err = resp.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpkt, err = parsePacket(raw, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 9)}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replyTo, _ := r.matchWindow(rpkt, "vlan.20"); len(replyTo) != 0 {
+		t.Fatalf("unsolicited answer must not match a window, got %v", replyTo)
+	}
+}
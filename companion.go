@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Apple companion follow-ups. Right after an _airplay/_raop response is
+// reflected, the querier issues A/AAAA lookups for the SRV target and a
+// _companion-link._tcp query — none of which mention the original service,
+// so service-filtered rules (and the wire prefilter) would drop them and
+// the stateful window on the reverse path would never open. For a short
+// time after such a response passes, queries for the names it referenced
+// are forwarded straight back to the interface the response came from.
+
+// companionTTL is how long follow-up names stay reflectable.
+const companionTTL = 10 * time.Second
+
+// companionServices are the service types whose responses trigger
+// assistance.
+var companionServices = map[string]bool{
+	"_airplay._tcp": true,
+	"_raop._tcp":    true,
+}
+
+// companionFollowUps are service queries expected shortly after.
+var companionFollowUps = []string{"_companion-link._tcp.local."}
+
+type companionEntry struct {
+	dst     string
+	expires time.Time
+}
+
+type companionAssist struct {
+	mu sync.Mutex
+	// names maps a lowercased owner name to the interface queries for it
+	// should be forwarded to.
+	names map[string]companionEntry
+}
+
+func newCompanionAssist() *companionAssist {
+	return &companionAssist{names: make(map[string]companionEntry)}
+}
+
+// observeResponse records the names referenced by a just-reflected
+// AirPlay response; respIface is where the response (and thus the
+// responder) lives.
+func (c *companionAssist) observeResponse(pkt *packet, respIface string) {
+	if !pkt.msg.Response || respIface == "" {
+		return
+	}
+	triggered := false
+	for _, svc := range pkt.services() {
+		if companionServices[svc] {
+			triggered = true
+			break
+		}
+	}
+	if !triggered {
+		return
+	}
+	expires := time.Now().Add(companionTTL)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	add := func(name string) {
+		c.names[strings.ToLower(name)] = companionEntry{dst: respIface, expires: expires}
+	}
+	for _, rr := range append(append([]dns.RR{}, pkt.msg.Answer...), pkt.msg.Extra...) {
+		if srv, ok := rr.(*dns.SRV); ok {
+			add(srv.Hdr.Name)
+			add(srv.Target)
+		}
+		if a, ok := rr.(*dns.A); ok {
+			add(a.Hdr.Name)
+		}
+	}
+	for _, name := range companionFollowUps {
+		add(name)
+	}
+}
+
+// match returns the interface a follow-up query should be forwarded to,
+// or "" when no question matches a live entry.
+func (c *companionAssist) match(pkt *packet) string {
+	if pkt.msg.Response {
+		return ""
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, q := range pkt.msg.Question {
+		e, ok := c.names[strings.ToLower(q.Name)]
+		if !ok {
+			continue
+		}
+		if now.After(e.expires) {
+			delete(c.names, strings.ToLower(q.Name))
+			continue
+		}
+		return e.dst
+	}
+	return ""
+}
+
+// active reports whether any entries are live, letting the wire prefilter
+// stand down while follow-ups are expected. Expired entries are pruned
+// here so the prefilter re-arms once the follow-up window closes, rather
+// than staying down forever on networks with steady AirPlay traffic.
+func (c *companionAssist) active() bool {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, e := range c.names {
+		if now.After(e.expires) {
+			delete(c.names, name)
+		}
+	}
+	return len(c.names) > 0
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the top-level structure of config.yaml.
+type Config struct {
+	// LogLevel filters log output: debug, info (default), warn, error.
+	LogLevel string `yaml:"log_level"`
+	// LogFormat selects "text" (default) or "json" encoding.
+	LogFormat string `yaml:"log_format"`
+	Debug     bool   `yaml:"debug"`
+
+	// Revision identifies this config deployment in metrics and events.
+	// When unset it defaults to a short hash of the file contents, so
+	// dashboards can still tell config generations apart.
+	Revision string `yaml:"revision"`
+
+	// LowMemory enables the reduced-footprint mode for small routers;
+	// see lowmem.go. MemoryLimitMB overrides its default heap ceiling.
+	LowMemory     bool `yaml:"low_memory"`
+	MemoryLimitMB int  `yaml:"memory_limit_mb"`
+
+	// QueryWindow is how long, in seconds, after reflecting a query the
+	// reflector will pass responses back in the other direction. Defaults
+	// to 5 seconds.
+	QueryWindow int `yaml:"query_window"`
+
+	Groups  []Group          `yaml:"groups"`
+	Rules   []Rule           `yaml:"rules"`
+	Clients []ClientOverride `yaml:"clients"`
+
+	// Templates holds parameterized rule bodies referenced by rules via
+	// template:/args:; see template.go.
+	Templates map[string]yaml.Node `yaml:"rule_templates"`
+
+	API          APIConfig          `yaml:"api"`
+	HealthChecks HealthConfig       `yaml:"health_checks"`
+	Unconfigured UnconfiguredConfig `yaml:"unconfigured_interfaces"`
+	Export       ExportConfig       `yaml:"export"`
+	// AnswerValidation checks that responses only claim the sender's own
+	// addresses; see validate.go.
+	AnswerValidation AnswerValidationConfig `yaml:"answer_validation"`
+	// ObserveOnly joins groups, classifies, builds inventory and emits
+	// metrics and events, but never puts a packet on the wire — for
+	// monitoring deployments, or auditing what reflection would do
+	// before enabling it.
+	ObserveOnly bool `yaml:"observe_only"`
+
+	// NamesPath is the on-disk device naming registry; see names.go.
+	NamesPath string `yaml:"names_path"`
+
+	// Syslog routes the daemon's logs to syslog; see syslogout.go.
+	Syslog SyslogConfig `yaml:"syslog"`
+
+	// AgentX registers core counters with the host snmpd; see agentx.go.
+	AgentX AgentXConfig `yaml:"agentx"`
+
+	// Journal writes events to systemd-journald; see journal.go.
+	Journal JournalConfig `yaml:"journal"`
+
+	// Ship forwards events to a remote collector; see ship.go.
+	Ship ShipConfig `yaml:"ship"`
+
+	// QuietHours suppresses reflection on a schedule; see quiet.go.
+	QuietHours QuietHoursConfig `yaml:"quiet_hours"`
+
+	// Corpus records anonymized packets for replay; see corpus.go.
+	Corpus CorpusConfig `yaml:"corpus"`
+
+	// History keeps a ring of recent packets per interface; see
+	// history.go.
+	History HistoryConfig `yaml:"history"`
+
+	// QueryRetry resends unanswered queries; see retry.go.
+	QueryRetry QueryRetryConfig `yaml:"query_retry"`
+
+	// QueryDedup coalesces repeated identical questions.
+	QueryDedup QueryDedupConfig `yaml:"query_dedup"`
+
+	// Fanout bounds per-packet destination fan-out and alarms on
+	// excessive amplification.
+	Fanout FanoutConfig `yaml:"fanout"`
+
+	// Privacy anonymizes names and addresses per output sink; see
+	// privacy.go.
+	Privacy PrivacyConfig `yaml:"privacy"`
+
+	// Mirrors are named packet-copy sinks for IDS integration; rules
+	// reference them by name. See mirror.go.
+	Mirrors []MirrorConfig `yaml:"mirrors"`
+
+	// Responder advertises the host's own services; see responder.go.
+	Responder ResponderConfig `yaml:"responder"`
+
+	// RecordCache answers repeat queries locally from cached responses;
+	// see rcache.go.
+	RecordCache RecordCacheConfig `yaml:"record_cache"`
+
+	// Anomaly quarantines sources minting new record names too fast;
+	// see anomaly.go.
+	Anomaly AnomalyConfig `yaml:"anomaly"`
+	// Ownership binds record names to the source that announced them;
+	// see ownership.go.
+	Ownership OwnershipConfig `yaml:"ownership"`
+	// PoisonGuard keeps a short value history per record and flags
+	// implausible changes; see poison.go.
+	PoisonGuard PoisonGuardConfig `yaml:"poison_guard"`
+	// Learning runs an initial permissive period that records real
+	// usage and suggests locked-down rules; see learning.go.
+	Learning LearningConfig `yaml:"learning"`
+	// Notifications POSTs device lifecycle events to webhooks; see
+	// notify.go.
+	Notifications NotificationsConfig `yaml:"notifications"`
+	// Peers are remote reflector instances reachable over unicast; a peer
+	// name is usable as a group in rules. See peer.go.
+	Peers []PeerConfig `yaml:"peers"`
+	// Hotplug tolerates configured interfaces that do not exist yet and
+	// follows kernel link events to join and leave them; see hotplug.go.
+	Hotplug bool `yaml:"hotplug"`
+	// LaxDecode recovers the question section of packets the strict
+	// parser rejects instead of dropping them; see laxdns.go.
+	LaxDecode bool `yaml:"lax_decode"`
+	// ExecHooks run external commands on selected events; see
+	// exechook.go.
+	ExecHooks []ExecHookConfig `yaml:"exec_hooks"`
+	// PayloadDedup suppresses identical payloads re-arriving right
+	// after being sent, breaking reflection loops; see storm.go.
+	PayloadDedup PayloadDedupConfig `yaml:"payload_dedup"`
+	// UniFi enriches device records from a UniFi controller; see
+	// unifi.go.
+	UniFi UniFiConfig `yaml:"unifi"`
+	// HomeAssistant publishes state and controls over MQTT discovery;
+	// see hass.go.
+	HomeAssistant HomeAssistantConfig `yaml:"home_assistant"`
+	// LegacyUnicast answers queries from non-5353 source ports with
+	// unicast replies; see legacy.go.
+	LegacyUnicast bool `yaml:"legacy_unicast"`
+	// Verifier probes advertised TCP endpoints for reachability; see
+	// verify.go.
+	Verifier VerifierConfig `yaml:"verifier"`
+
+	// StatePath, when set, receives a runtime-state snapshot on shutdown
+	// that the next process restores at startup; see statefile.go.
+	StatePath string `yaml:"state_path"`
+
+	// UnicastFallback answers .local queries arriving over unicast DNS;
+	// see unicastdns.go.
+	UnicastFallback UnicastFallbackConfig `yaml:"unicast_fallback"`
+}
+
+// UnconfiguredConfig controls what happens to packets arriving on
+// interfaces that are not part of any group. The default ("ignore") drops
+// them silently; "log" logs and counts them so misspelled interface names
+// are discoverable. Setting Group additionally treats such packets as if
+// they arrived on the named group.
+type UnconfiguredConfig struct {
+	Action string `yaml:"action"`
+	Group  string `yaml:"group"`
+}
+
+// APIConfig configures the optional HTTP listener for metrics and runtime
+// inspection.
+type APIConfig struct {
+	Listen string `yaml:"listen"`
+
+	// TLS serves the listener over HTTPS; see tlsconfig.go.
+	TLS APITLSConfig `yaml:"tls"`
+}
+
+// HealthConfig configures periodic end-to-end reflection checks. Group is
+// the user-side group probes are sent from; checks are disabled when it is
+// empty. Interval and Timeout are in seconds.
+type HealthConfig struct {
+	Group    string `yaml:"group"`
+	Interval int    `yaml:"interval"`
+	Timeout  int    `yaml:"timeout"`
+}
+
+// Group names a set of interfaces that share a reflection policy,
+// typically one VLAN or network segment per group.
+//
+// A group may additionally (or instead) be defined by source subnets: a
+// packet whose source IP falls in one of Subnets is classified into this
+// group even if its interface belongs to another group. This lets several
+// subnets sharing one physical interface (secondary addressing, guest
+// overlays) carry distinct policies.
+type Group struct {
+	Name       string   `yaml:"name"`
+	Interfaces []string `yaml:"interfaces"`
+	Subnets    []string `yaml:"subnets"`
+	// Wifi marks the group's segments as wireless: responses reflected into
+	// it are converted to per-client unicast when the querier is known,
+	// since multicast on Wi-Fi is transmitted at slow legacy rates.
+	Wifi bool `yaml:"wifi"`
+	// Budget caps reflected traffic into this group; see budget.go.
+	Budget Budget `yaml:"budget"`
+
+	// QuietHours overrides the global schedule for this group.
+	QuietHours QuietHoursConfig `yaml:"quiet_hours"`
+
+	// Vrf binds this group's traffic into a Linux VRF: the reflector
+	// opens a dedicated socket with SO_BINDTODEVICE on the VRF device so
+	// receive and send work on VRF-segmented routers.
+	Vrf string `yaml:"vrf"`
+
+	// SendPolicy controls fan-out when the group maps to several
+	// physical interfaces. "all" (the default) sends on every member;
+	// "primary" sends only on the first healthy member, failing over to
+	// the next when it degrades — for bonded or redundant links where
+	// duplicating onto every NIC double-delivers on the bridged segment.
+	SendPolicy string `yaml:"send_policy"`
+	// AddressFamily translates A/AAAA records for single-stack segments;
+	// see family.go.
+	AddressFamily AddressFamilyConfig `yaml:"address_family"`
+
+	subnets []*net.IPNet
+}
+
+// containsIP reports whether ip falls in one of the group's subnets.
+func (g *Group) containsIP(ip net.IP) bool {
+	for _, n := range g.subnets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule forwards packets arriving on the From group to the To groups when
+// the packet passes Filter.
+type Rule struct {
+	// Name appears in logs, metric labels, events and API output
+	// instead of the opaque rule index; Description is free-form
+	// context for other admins reading the config or the API.
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+
+	From   string   `yaml:"from"`
+	To     []string `yaml:"to"`
+	Filter Filter   `yaml:"filter"`
+
+	// DelayMS and JitterMS delay reflected responses by delay_ms plus a
+	// uniform random 0..jitter_ms milliseconds, in the spirit of the RFC
+	// 6762 §6 response scheduling guidance: when one reflected query
+	// wakes many devices, spreading their reflected answers avoids a
+	// synchronized burst on Wi-Fi segments. Queries are never delayed.
+	DelayMS  int `yaml:"delay_ms"`
+	JitterMS int `yaml:"jitter_ms"`
+
+	// Mirror also copies every packet this rule matches to the named
+	// mirror sink.
+	Mirror string `yaml:"mirror"`
+
+	// Log overrides reflection logging for this rule: "all" logs every
+	// reflected packet even outside debug mode, "none" silences it even
+	// in debug mode. Empty inherits the global debug setting.
+	Log string `yaml:"log"`
+
+	// MaxFanout caps this rule's destinations, overriding the global
+	// fanout.max_destinations when set.
+	MaxFanout int `yaml:"max_fanout"`
+
+	// MultiQuestion decides what happens to a query carrying several
+	// questions when only some pass this rule's service filter:
+	// "forward" (the default) forwards the packet whole, "strip"
+	// forwards it with the non-matching questions removed, and "split"
+	// forwards each matching question as its own single-question query.
+	MultiQuestion string `yaml:"multi_question"`
+
+	// RateLimit bounds how fast each source IP may use this rule; see
+	// ratelimit.go.
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+
+	// Scrub strips record types or owner names from the responses this
+	// rule reflects; see scrub.go.
+	Scrub ScrubConfig `yaml:"scrub"`
+
+	// QUPolicy decides what happens to the RFC 6762 unicast-response
+	// (QU) bit on reflected questions: "strip" (the default) clears it
+	// so responders answer by multicast, "preserve" forwards it
+	// untouched for flat networks where multicast load matters, and
+	// "answer-unicast" keeps it and has the reflector relay the unicast
+	// response back to the querier itself.
+	QUPolicy string `yaml:"qu_policy"`
+
+	// ReflectWithinSourceGroup opts a rule into reflecting back onto
+	// sibling interfaces of the packet's own group when that group also
+	// appears in To. The default (false) excludes the whole source
+	// group, not just the source interface, preventing accidental
+	// intra-group amplification.
+	ReflectWithinSourceGroup bool `yaml:"reflect_within_source_group"`
+
+	// Template and Args instantiate a rule template instead of spelling
+	// the rule out inline; see template.go.
+	Template string               `yaml:"template"`
+	Args     map[string]yaml.Node `yaml:"args"`
+}
+
+// label identifies a rule in logs and metrics: its name, or "rule N"
+// when unnamed.
+func (r *Rule) label(i int) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("rule %d", i)
+}
+
+// shapeQuestions applies the rule's multi_question policy to a query,
+// returning the packet(s) to forward. Responses and single-question
+// queries pass through untouched, as does a query whose questions all
+// match: the policy only costs a repack when it changes the packet.
+func (r *Rule) shapeQuestions(pkt *packet) []*packet {
+	if r.MultiQuestion == "" || r.MultiQuestion == "forward" ||
+		pkt.msg.Response || len(pkt.msg.Question) <= 1 {
+		return []*packet{pkt}
+	}
+	var keep []dns.Question
+	for _, q := range pkt.msg.Question {
+		if r.Filter.matchQuestion(q) {
+			keep = append(keep, q)
+		}
+	}
+	if len(keep) == 0 {
+		// The packet matched on something other than its questions;
+		// stripping them all would forward an empty query.
+		return []*packet{pkt}
+	}
+	if r.MultiQuestion == "strip" {
+		if len(keep) == len(pkt.msg.Question) {
+			return []*packet{pkt}
+		}
+		if np := pkt.withQuestions(keep); np != nil {
+			return []*packet{np}
+		}
+		return []*packet{pkt}
+	}
+	out := make([]*packet, 0, len(keep))
+	for _, q := range keep {
+		if np := pkt.withQuestions([]dns.Question{q}); np != nil {
+			out = append(out, np)
+		}
+	}
+	if len(out) == 0 {
+		return []*packet{pkt}
+	}
+	return out
+}
+
+// delay returns this rule's randomized forwarding delay for responses.
+func (r *Rule) delay() time.Duration {
+	if r.DelayMS <= 0 && r.JitterMS <= 0 {
+		return 0
+	}
+	d := time.Duration(r.DelayMS) * time.Millisecond
+	if r.JitterMS > 0 {
+		d += time.Duration(rand.Int63n(int64(r.JitterMS)+1)) * time.Millisecond
+	}
+	return d
+}
+
+// LoadConfig reads and validates the YAML configuration at path.
+func LoadConfig(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ParseConfig(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig decodes and validates a raw YAML configuration.
+func ParseConfig(raw []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	if err := cfg.expandTemplates(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.QueryWindow <= 0 {
+		cfg.QueryWindow = 5
+	}
+	if cfg.Revision == "" {
+		sum := sha256.Sum256(raw)
+		cfg.Revision = hex.EncodeToString(sum[:4])
+	}
+	return &cfg, nil
+}
+
+func (c *Config) validate() error {
+	if len(c.Groups) == 0 {
+		return fmt.Errorf("no groups configured")
+	}
+	if err := c.Privacy.validate(); err != nil {
+		return err
+	}
+	switch strings.ToLower(c.LogLevel) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		return fmt.Errorf("unknown log_level %q", c.LogLevel)
+	}
+	switch c.LogFormat {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unknown log_format %q (use text or json)", c.LogFormat)
+	}
+	groupNames := make(map[string]bool)
+	for i := range c.Groups {
+		groupNames[c.Groups[i].Name] = true
+	}
+	if err := c.Responder.validate(groupNames); err != nil {
+		return err
+	}
+	mirrorNames := make(map[string]bool)
+	for i := range c.Mirrors {
+		if err := c.Mirrors[i].validate(); err != nil {
+			return err
+		}
+		if mirrorNames[c.Mirrors[i].Name] {
+			return fmt.Errorf("duplicate mirror name %q", c.Mirrors[i].Name)
+		}
+		mirrorNames[c.Mirrors[i].Name] = true
+	}
+	for i := range c.Rules {
+		if m := c.Rules[i].Mirror; m != "" && !mirrorNames[m] {
+			return fmt.Errorf("rule %d: unknown mirror %q", i, m)
+		}
+	}
+	c.Fanout.compile()
+	c.Anomaly.compile()
+	if err := c.Ownership.validate(); err != nil {
+		return err
+	}
+	if err := c.PoisonGuard.validate(); err != nil {
+		return err
+	}
+	if err := c.Learning.validate(); err != nil {
+		return err
+	}
+	for i := range c.Notifications.Webhooks {
+		if err := c.Notifications.Webhooks[i].validate(); err != nil {
+			return err
+		}
+	}
+	if err := c.QueryDedup.compile(); err != nil {
+		return err
+	}
+	if err := c.PayloadDedup.compile(); err != nil {
+		return err
+	}
+	if err := c.UniFi.validate(); err != nil {
+		return err
+	}
+	if err := c.HomeAssistant.validate(); err != nil {
+		return err
+	}
+	if err := c.Verifier.validate(); err != nil {
+		return err
+	}
+	if err := c.QuietHours.compile(); err != nil {
+		return err
+	}
+	if err := c.Syslog.validate(); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for i, g := range c.Groups {
+		if g.Name == "" {
+			return fmt.Errorf("group %d has no name", i)
+		}
+		if names[g.Name] {
+			return fmt.Errorf("duplicate group name %q", g.Name)
+		}
+		names[g.Name] = true
+		if len(g.Interfaces) == 0 && len(g.Subnets) == 0 {
+			return fmt.Errorf("group %q has no interfaces and no subnets", g.Name)
+		}
+		for _, s := range g.Subnets {
+			_, ipnet, err := net.ParseCIDR(s)
+			if err != nil {
+				return fmt.Errorf("group %q: subnet %q: %w", g.Name, s, err)
+			}
+			c.Groups[i].subnets = append(c.Groups[i].subnets, ipnet)
+		}
+		if err := c.Groups[i].Budget.compile(); err != nil {
+			return fmt.Errorf("group %q: %w", g.Name, err)
+		}
+		if err := c.Groups[i].QuietHours.compile(); err != nil {
+			return fmt.Errorf("group %q: %w", g.Name, err)
+		}
+		switch g.SendPolicy {
+		case "", "all", "primary":
+		default:
+			return fmt.Errorf("group %q: unknown send_policy %q", g.Name, g.SendPolicy)
+		}
+		if err := c.Groups[i].AddressFamily.compile(); err != nil {
+			return fmt.Errorf("group %q: %w", g.Name, err)
+		}
+	}
+	for i := range c.ExecHooks {
+		if err := c.ExecHooks[i].validate(); err != nil {
+			return err
+		}
+	}
+	for i := range c.Peers {
+		if err := c.Peers[i].validate(); err != nil {
+			return err
+		}
+		pn := c.Peers[i].Name
+		if names[pn] {
+			return fmt.Errorf("peer %q: name collides with a group or peer", pn)
+		}
+		names[pn] = true
+	}
+	for i, r := range c.Rules {
+		if !names[r.From] {
+			return fmt.Errorf("rule %d: unknown group %q in from", i, r.From)
+		}
+		if len(r.To) == 0 {
+			return fmt.Errorf("rule %d: empty to", i)
+		}
+		for _, to := range r.To {
+			if !names[to] {
+				return fmt.Errorf("rule %d: unknown group %q in to", i, to)
+			}
+		}
+		if r.Name != "" {
+			for j := 0; j < i; j++ {
+				if c.Rules[j].Name == r.Name {
+					return fmt.Errorf("rule %d: duplicate rule name %q", i, r.Name)
+				}
+			}
+		}
+		switch r.Log {
+		case "", "all", "none":
+		default:
+			return fmt.Errorf("rule %d: unknown log mode %q (use all or none)", i, r.Log)
+		}
+		switch r.MultiQuestion {
+		case "", "forward", "strip", "split":
+		default:
+			return fmt.Errorf("rule %d: unknown multi_question policy %q (use forward, strip or split)", i, r.MultiQuestion)
+		}
+		switch r.QUPolicy {
+		case "", "strip", "preserve", "answer-unicast":
+		default:
+			return fmt.Errorf("rule %d: unknown qu_policy %q (use strip, preserve or answer-unicast)", i, r.QUPolicy)
+		}
+		if r.MaxFanout < 0 {
+			return fmt.Errorf("rule %d: max_fanout must be non-negative", i)
+		}
+		if r.DelayMS < 0 || r.JitterMS < 0 {
+			return fmt.Errorf("rule %d: delay_ms and jitter_ms must not be negative", i)
+		}
+		if err := c.Rules[i].Filter.compile(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		if err := c.Rules[i].RateLimit.compile(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		if err := c.Rules[i].Scrub.compile(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	for i := range c.Clients {
+		if err := c.Clients[i].compile(names); err != nil {
+			return fmt.Errorf("clients entry %d: %w", i, err)
+		}
+	}
+	switch c.Unconfigured.Action {
+	case "", "ignore", "log":
+	default:
+		return fmt.Errorf("unconfigured_interfaces: action must be ignore or log, got %q", c.Unconfigured.Action)
+	}
+	if c.Unconfigured.Group != "" && !names[c.Unconfigured.Group] {
+		return fmt.Errorf("unconfigured_interfaces: unknown group %q", c.Unconfigured.Group)
+	}
+	if err := c.Export.compile(); err != nil {
+		return err
+	}
+	if err := c.AnswerValidation.compile(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// peer returns the named peer, or nil.
+func (c *Config) peer(name string) *PeerConfig {
+	for i := range c.Peers {
+		if c.Peers[i].Name == name {
+			return &c.Peers[i]
+		}
+	}
+	return nil
+}
+
+// group returns the named group, or nil.
+func (c *Config) group(name string) *Group {
+	for i := range c.Groups {
+		if c.Groups[i].Name == name {
+			return &c.Groups[i]
+		}
+	}
+	return nil
+}
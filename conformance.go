@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// RFC 6762 conformance warnings. Some violations actively break
+// reflection — a response sent from an ephemeral port cannot be answered
+// to port 5353, a TTL under 255 makes receivers discard the packet after
+// reflection, a unicast-destined response never reaches the group. These
+// come from specific buggy devices, so the warnings name the source (with
+// its assigned label when one exists) and are rate-limited per device and
+// violation so one chatty printer cannot flood the journal.
+
+// conformanceWarnInterval is the per-device, per-violation log rate limit.
+const conformanceWarnInterval = 5 * time.Minute
+
+// conformanceOversize is the payload size beyond which a packet no longer
+// fits a standard Ethernet MTU with headers (RFC 6762 §17).
+const conformanceOversize = 1472
+
+type conformanceMonitor struct {
+	mu       sync.Mutex
+	lastWarn map[string]time.Time
+}
+
+func newConformanceMonitor() *conformanceMonitor {
+	return &conformanceMonitor{lastWarn: make(map[string]time.Time)}
+}
+
+// observe checks one received datagram against the conformance rules. It
+// works on the raw wire form so it costs nothing extra on the parse path.
+func (c *conformanceMonitor) observe(payload []byte, src *net.UDPAddr, meta rxMeta, iface string) {
+	response, ok := wireIsResponse(payload)
+	if !ok {
+		return
+	}
+	if response && src.Port != mdnsGroup.Port {
+		c.warn(src, iface, "source-port", fmt.Sprintf("response from port %d, not 5353", src.Port))
+	}
+	if meta.ttl > 0 && meta.ttl != 255 {
+		c.warn(src, iface, "ttl", fmt.Sprintf("IP TTL %d, not 255", meta.ttl))
+	}
+	if response && meta.dst != nil && !meta.dst.IsMulticast() {
+		c.warn(src, iface, "unicast-response", fmt.Sprintf("response addressed to unicast %v", meta.dst))
+	}
+	if len(payload) > conformanceOversize {
+		c.warn(src, iface, "oversized", fmt.Sprintf("%d-byte packet exceeds a standard MTU", len(payload)))
+	}
+}
+
+// warn counts a violation and logs it, rate-limited per device and kind.
+func (c *conformanceMonitor) warn(src *net.UDPAddr, iface, kind, detail string) {
+	metrics.Inc("mdns_conformance_total", Labels{"kind": kind, "iface": iface})
+	key := src.IP.String() + "\x00" + kind
+	now := time.Now()
+	c.mu.Lock()
+	recent := now.Sub(c.lastWarn[key]) < conformanceWarnInterval
+	if !recent {
+		c.lastWarn[key] = now
+	}
+	c.mu.Unlock()
+	if recent {
+		return
+	}
+	who := src.IP.String()
+	mac := lookupMAC(src.IP)
+	label := deviceNames.lookup(mac)
+	if label == "" {
+		label = unifiDir.lookup(mac).Label
+	}
+	if label != "" {
+		who += " (" + label + ")"
+	}
+	log.Printf("conformance: %s on %s: %s", who, iface, detail)
+}
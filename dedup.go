@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// QueryDedupConfig coalesces repeated identical questions. Chatty service
+// types (_googlecast is queried every few seconds by every sender) can be
+// aggressively deduplicated while rare types are never delayed.
+type QueryDedupConfig struct {
+	// DefaultMS is the horizon in milliseconds applied to service types
+	// without an explicit entry. 0 disables dedup for them.
+	DefaultMS int `yaml:"default_ms"`
+	// Services maps a service type ("_googlecast._tcp") to its horizon in
+	// milliseconds, overriding DefaultMS.
+	Services map[string]int `yaml:"services"`
+
+	defaultHorizon time.Duration
+	horizons       map[string]time.Duration
+}
+
+func (c *QueryDedupConfig) compile() error {
+	if c.DefaultMS < 0 {
+		return fmt.Errorf("query_dedup: default_ms must not be negative")
+	}
+	c.defaultHorizon = time.Duration(c.DefaultMS) * time.Millisecond
+	c.horizons = make(map[string]time.Duration, len(c.Services))
+	for svc, ms := range c.Services {
+		if ms < 0 {
+			return fmt.Errorf("query_dedup: horizon for %s must not be negative", svc)
+		}
+		vetServiceType(svc, "query_dedup.services")
+		c.horizons[normalizeService(svc)] = time.Duration(ms) * time.Millisecond
+	}
+	return nil
+}
+
+// horizonFor returns the dedup horizon for one question name.
+func (c *QueryDedupConfig) horizonFor(name string) time.Duration {
+	if h, ok := c.horizons[serviceOfName(name)]; ok {
+		return h
+	}
+	return c.defaultHorizon
+}
+
+// dedupTable remembers when each question was last reflected per source
+// interface, so identical repeats inside the horizon are suppressed.
+type dedupTable struct {
+	cfg  *QueryDedupConfig
+	clk  clock
+	mu   sync.Mutex
+	seen map[string]time.Time // iface + question name + qtype -> last reflected
+}
+
+func newDedupTable(cfg *QueryDedupConfig) *dedupTable {
+	return &dedupTable{cfg: cfg, clk: realClock{}, seen: make(map[string]time.Time)}
+}
+
+// duplicate reports whether every question in a query was already reflected
+// inside its horizon. Fresh questions are recorded, and a packet with any
+// fresh question is forwarded whole; the repo reflects packets, not
+// individual questions.
+func (d *dedupTable) duplicate(pkt *packet, srcIface string) bool {
+	if pkt.msg.Response || len(pkt.msg.Question) == 0 {
+		return false
+	}
+	now := d.clk.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dup := true
+	for _, q := range pkt.msg.Question {
+		h := d.cfg.horizonFor(q.Name)
+		if h <= 0 {
+			dup = false
+			continue
+		}
+		key := srcIface + "\x00" + q.Name + "\x00" + dns.TypeToString[q.Qtype]
+		if last, ok := d.seen[key]; !ok || now.Sub(last) >= h {
+			dup = false
+			// Only fresh questions advance the timestamp: refreshing it
+			// on suppressed repeats would let a fast querier be
+			// suppressed forever instead of once per horizon.
+			d.seen[key] = now
+		}
+	}
+	if len(d.seen) > 4096 {
+		d.sweep(now)
+	}
+	return dup
+}
+
+// sweep drops entries older than the largest configured horizon; the
+// caller holds d.mu.
+func (d *dedupTable) sweep(now time.Time) {
+	max := d.cfg.defaultHorizon
+	for _, h := range d.cfg.horizons {
+		if h > max {
+			max = h
+		}
+	}
+	for key, last := range d.seen {
+		if now.Sub(last) >= max {
+			delete(d.seen, key)
+		}
+	}
+}
+
+// setConfig swaps the horizons on config reload.
+func (d *dedupTable) setConfig(cfg *QueryDedupConfig) {
+	d.mu.Lock()
+	d.cfg = cfg
+	d.mu.Unlock()
+}
+
+// export copies the table for the state file.
+func (d *dedupTable) export() map[string]time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make(map[string]time.Time, len(d.seen))
+	for k, v := range d.seen {
+		out[k] = v
+	}
+	return out
+}
+
+// restore merges entries from an imported state file.
+func (d *dedupTable) restore(seen map[string]time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k, v := range seen {
+		d.seen[k] = v
+	}
+}
+
+// flush clears the table.
+func (d *dedupTable) flush() {
+	d.mu.Lock()
+	d.seen = make(map[string]time.Time)
+	d.mu.Unlock()
+}
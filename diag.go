@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// snoopingDiag is the per-interface result of the snooping diagnostics:
+// whether the kernel reports the mDNS group joined, how long ago any mDNS
+// packet was received, and heuristics pointing at switch-side IGMP
+// snooping or filtering problems.
+type snoopingDiag struct {
+	Iface          string   `json:"iface"`
+	GroupJoined    bool     `json:"group_joined"`
+	LastPacketSecs float64  `json:"last_packet_secs"`
+	ProbeSent      bool     `json:"probe_sent"`
+	Hints          []string `json:"hints"`
+}
+
+// mdnsGroupIGMPHex is 224.0.0.251 as it appears in /proc/net/igmp
+// (little-endian hex).
+const mdnsGroupIGMPHex = "FB0000E0"
+
+// diagnoseSnooping runs the snooping diagnostics across all configured
+// interfaces. It sends a probe query on each interface so a subsequent run
+// can observe whether traffic flows at all.
+func (r *Reflector) diagnoseSnooping() []snoopingDiag {
+	joined := igmpMemberships()
+	probe := new(dns.Msg)
+	probe.Question = append(probe.Question, dns.Question{
+		Name:   "_services._dns-sd._udp.local.",
+		Qtype:  dns.TypePTR,
+		Qclass: dns.ClassINET,
+	})
+	wire, err := probe.Pack()
+	probeOK := err == nil
+
+	var out []snoopingDiag
+	r.mu.Lock()
+	names := make([]string, 0, len(r.ifaces))
+	for name := range r.ifaces {
+		names = append(names, name)
+	}
+	lastRx := make(map[string]time.Time, len(r.lastRx))
+	for k, v := range r.lastRx {
+		lastRx[k] = v
+	}
+	r.mu.Unlock()
+
+	anyTraffic := false
+	for _, name := range names {
+		if !lastRx[name].IsZero() && time.Since(lastRx[name]) < 2*time.Minute {
+			anyTraffic = true
+		}
+	}
+	for _, name := range names {
+		d := snoopingDiag{Iface: name, GroupJoined: joined[name]}
+		if probeOK {
+			r.send(wire, name)
+			d.ProbeSent = true
+		}
+		if !lastRx[name].IsZero() {
+			d.LastPacketSecs = time.Since(lastRx[name]).Seconds()
+		} else {
+			d.LastPacketSecs = -1
+		}
+		if !d.GroupJoined {
+			d.Hints = append(d.Hints, "kernel does not report 224.0.0.251 joined on this interface; check interface state and MULTICAST flag")
+		}
+		if d.GroupJoined && d.LastPacketSecs < 0 {
+			hint := "group joined but no mDNS traffic ever received"
+			if anyTraffic {
+				hint += "; other interfaces see traffic, so the switch is likely filtering multicast here (IGMP snooping without a querier is the usual cause)"
+			}
+			d.Hints = append(d.Hints, hint)
+		} else if d.GroupJoined && d.LastPacketSecs > 300 {
+			d.Hints = append(d.Hints, fmt.Sprintf("no mDNS traffic for %.0fs; if devices exist on this segment, suspect snooping timeout on the switch", d.LastPacketSecs))
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// igmpMemberships parses /proc/net/igmp and reports, per interface name,
+// whether the mDNS group is joined.
+func igmpMemberships() map[string]bool {
+	out := make(map[string]bool)
+	raw, err := os.ReadFile("/proc/net/igmp")
+	if err != nil {
+		return out
+	}
+	current := ""
+	for _, line := range strings.Split(string(raw), "\n") {
+		if !strings.HasPrefix(line, "\t") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] != "Idx" {
+				current = fields[1]
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 1 && strings.EqualFold(fields[0], mdnsGroupIGMPHex) && current != "" {
+			out[current] = true
+		}
+	}
+	return out
+}
+
+// snoopingHandler serves GET /diagnostics/snooping.
+func (a *apiServer) snoopingHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.r.diagnoseSnooping())
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// classQU is the top bit of a question's QCLASS, requesting a unicast
+// response (RFC 6762 §5.4). The same bit in a resource record's class is
+// the cache-flush bit.
+const classQU = 1 << 15
+
+// packet is one received mDNS message together with its network origin.
+type packet struct {
+	payload []byte
+	msg     *dns.Msg
+	src     *net.UDPAddr
+	ifindex int
+	// solicited is set by the reflector when the response arrived inside
+	// an open query window; it feeds the solicited-response packet class.
+	solicited bool
+	// lax marks a packet recovered by the fallback parser; its msg holds
+	// only the header bits and questions, so the payload is forwarded
+	// verbatim rather than repacked. See laxdns.go.
+	lax bool
+	// keepQU leaves the unicast-response bit on reflected questions;
+	// quRelay additionally marks the window so the unicast response is
+	// relayed back to the querier. Both are set per rule by qu_policy.
+	keepQU bool
+	// scrub, set per rule, rides the query into its window so the
+	// relayed response is scrubbed too; see scrub.go.
+	scrub   *ScrubConfig
+	quRelay bool
+}
+
+// class returns the finer packet classification used by filter types:
+// "probe" (query carrying proposed records in the authority section),
+// "query", "goodbye" (response retracting records with TTL 0),
+// "solicited-response" or "announcement".
+func (p *packet) class() string {
+	if !p.msg.Response {
+		if len(p.msg.Ns) > 0 {
+			return "probe"
+		}
+		return "query"
+	}
+	goodbye := len(p.msg.Answer) > 0
+	for _, rr := range p.msg.Answer {
+		if rr.Header().Ttl != 0 {
+			goodbye = false
+			break
+		}
+	}
+	if goodbye {
+		return "goodbye"
+	}
+	if p.solicited {
+		return "solicited-response"
+	}
+	return "announcement"
+}
+
+// parsePacket decodes payload into a packet. The payload slice is retained.
+func parsePacket(payload []byte, src *net.UDPAddr, ifindex int) (*packet, error) {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(payload); err != nil {
+		return nil, err
+	}
+	return &packet{payload: payload, msg: msg, src: src, ifindex: ifindex}, nil
+}
+
+// classesSane reports whether every class in the message is plausible for
+// mDNS: questions must be IN (or ANY, seen from some probing stacks) once
+// the QU bit is masked, and resource records must be IN once the
+// cache-flush bit is masked. Anything else is almost always a corrupt or
+// hostile packet.
+func (p *packet) classesSane() bool {
+	for _, q := range p.msg.Question {
+		switch q.Qclass &^ classQU {
+		case dns.ClassINET, dns.ClassANY:
+		default:
+			return false
+		}
+	}
+	for _, set := range [][]dns.RR{p.msg.Answer, p.msg.Ns, p.msg.Extra} {
+		for _, rr := range set {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			if rr.Header().Class&^classQU != dns.ClassINET {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// services returns the normalized service types mentioned in the packet's
+// questions and answers, e.g. "_airplay._tcp" from a question for
+// "_airplay._tcp.local.".
+func (p *packet) services() []string {
+	seen := make(map[string]bool)
+	var out []string
+	add := func(name string) {
+		if s := serviceOfName(name); s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	for _, q := range p.msg.Question {
+		add(q.Name)
+	}
+	for _, rr := range p.msg.Answer {
+		add(rr.Header().Name)
+		if ptr, ok := rr.(*dns.PTR); ok {
+			add(ptr.Ptr)
+		}
+	}
+	for _, rr := range p.msg.Extra {
+		add(rr.Header().Name)
+	}
+	return out
+}
+
+// serviceOfName extracts the "_service._proto" part of an mDNS name, or ""
+// if the name does not look like a service name.
+func serviceOfName(name string) string {
+	labels := dns.SplitDomainName(name)
+	for i := 0; i+1 < len(labels); i++ {
+		if labels[i+1] == "_tcp" || labels[i+1] == "_udp" {
+			if strings.HasPrefix(labels[i], "_") {
+				return normalizeService(labels[i] + "." + labels[i+1])
+			}
+		}
+	}
+	return ""
+}
+
+// withQuestions returns a copy of a query carrying only the given
+// questions, repacked, or nil if packing fails.
+func (p *packet) withQuestions(qs []dns.Question) *packet {
+	msg := p.msg.Copy()
+	msg.Question = qs
+	payload, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	return &packet{payload: payload, msg: msg, src: p.src, ifindex: p.ifindex, solicited: p.solicited}
+}
+
+// stripQU clears the unicast-response bit from every question and reports
+// whether the message was modified. Reflected queries must not carry the QU
+// bit: the responder would unicast its reply to the reflector's segment
+// address and the reply would never be reflected back.
+func (p *packet) stripQU() bool {
+	modified := false
+	for i := range p.msg.Question {
+		if p.msg.Question[i].Qclass&classQU != 0 {
+			p.msg.Question[i].Qclass &^= classQU
+			modified = true
+		}
+	}
+	return modified
+}
+
+// wire returns the payload to put on the wire. Responses are always passed
+// through byte-for-byte; queries are repacked only when stripQU modified
+// them, so TXT records and other payload survive reflection unmodified.
+func (p *packet) wire() ([]byte, error) {
+	if p.lax {
+		return p.payload, nil
+	}
+	if p.keepQU {
+		return p.payload, nil
+	}
+	if !p.msg.Response && p.stripQU() {
+		return p.msg.Pack()
+	}
+	return p.payload, nil
+}
+
+// getMsgSummary renders a short human-readable description of the message
+// for logging.
+func getMsgSummary(msg *dns.Msg) string {
+	var b strings.Builder
+	if msg.Response {
+		b.WriteString("response")
+	} else {
+		b.WriteString("query")
+	}
+	for _, q := range msg.Question {
+		fmt.Fprintf(&b, " ?%s/%s", strings.TrimSuffix(q.Name, "."), dns.TypeToString[q.Qtype])
+	}
+	for _, rr := range msg.Answer {
+		h := rr.Header()
+		fmt.Fprintf(&b, " !%s/%s", strings.TrimSuffix(h.Name, "."), dns.TypeToString[h.Rrtype])
+	}
+	if n := len(msg.Extra); n > 0 {
+		fmt.Fprintf(&b, " +%d extra", n)
+	}
+	return b.String()
+}
@@ -0,0 +1,27 @@
+package main
+
+import "log"
+
+// errorCategory classifies failures so dashboards can break them down and
+// alerts can target a specific class of problem.
+type errorCategory string
+
+const (
+	errSocket  errorCategory = "socket"
+	errParse   errorCategory = "parse"
+	errConfig  errorCategory = "config"
+	errForward errorCategory = "forward"
+	errState   errorCategory = "state"
+)
+
+// reportError logs a failure with its category, counts it in
+// mdns_errors_total and publishes it on the event bus.
+func (r *Reflector) reportError(cat errorCategory, context string, err error) {
+	log.Printf("%s error: %s: %v", cat, context, err)
+	metrics.Inc("mdns_errors_total", Labels{"category": string(cat)})
+	r.events.publish(Event{
+		Type:     "error",
+		Category: string(cat),
+		Summary:  context + ": " + err.Error(),
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is one observable occurrence in the daemon. Decision events are
+// published for every packet verdict; other event types will share the
+// same bus.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Iface    string    `json:"iface,omitempty"`
+	SrcIP    string    `json:"src_ip,omitempty"`
+	Device   string    `json:"device,omitempty"`
+	Rule     string    `json:"rule,omitempty"`
+	Action   string    `json:"action,omitempty"`
+	Category string    `json:"category,omitempty"`
+	Summary  string    `json:"summary,omitempty"`
+	Revision string    `json:"revision,omitempty"`
+	Dsts     []string  `json:"destinations,omitempty"`
+}
+
+// eventBus fans events out to live subscribers (the /events endpoint).
+// Publishing never blocks: a subscriber that cannot keep up loses events
+// rather than stalling the packet path.
+type eventBus struct {
+	mu       sync.Mutex
+	subs     map[chan Event]struct{}
+	revision string
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[chan Event]struct{})}
+}
+
+// setRevision stamps subsequently published events with the config
+// revision.
+func (b *eventBus) setRevision(rev string) {
+	b.mu.Lock()
+	b.revision = rev
+	b.mu.Unlock()
+}
+
+func (b *eventBus) publish(ev Event) {
+	ev.Time = time.Now()
+	b.mu.Lock()
+	if ev.Revision == "" {
+		ev.Revision = b.revision
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+	b.mu.Unlock()
+}
+
+func (b *eventBus) subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	cancel := func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+	return ch, cancel
+}
+
+// hasSubscribers reports whether anyone is listening, so hot paths can
+// skip building events nobody will see.
+func (b *eventBus) hasSubscribers() bool {
+	b.mu.Lock()
+	n := len(b.subs)
+	b.mu.Unlock()
+	return n > 0
+}
+
+// eventsHandler streams live decision events. With Accept:
+// text/event-stream the response is SSE; otherwise newline-delimited JSON.
+// Query parameters iface, rule and host narrow the stream.
+func (a *apiServer) eventsHandler(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	sse := strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+
+	wantIface := req.URL.Query().Get("iface")
+	wantRule := req.URL.Query().Get("rule")
+	wantHost := req.URL.Query().Get("host")
+
+	privacy := a.r.config().Privacy.Events
+	ch, cancel := a.r.events.subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case ev := <-ch:
+			if wantIface != "" && ev.Iface != wantIface {
+				continue
+			}
+			if wantRule != "" && ev.Rule != wantRule {
+				continue
+			}
+			if wantHost != "" && ev.SrcIP != wantHost {
+				continue
+			}
+			line, err := json.Marshal(scrubEvent(ev, privacy))
+			if err != nil {
+				continue
+			}
+			if sse {
+				fmt.Fprintf(w, "data: %s\n\n", line)
+			} else {
+				fmt.Fprintf(w, "%s\n", line)
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Exec hooks. Shipping events to HTTP and syslog covers fleet tooling,
+// but on a single router the integration people actually want is "run
+// this script when X happens". An exec hook runs a configured command
+// for selected event types, with the event JSON on stdin and the common
+// fields in MDNS_EVENT_* environment variables. One instance per hook
+// runs at a time; events arriving while a hook is busy are skipped and
+// counted, so a slow script cannot pile up processes.
+
+// ExecHookConfig is one command bound to event types.
+type ExecHookConfig struct {
+	// Command is the program to run; Args are passed verbatim.
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	// Events selects the event types that trigger the hook; empty
+	// means all.
+	Events []string `yaml:"events"`
+	// TimeoutSeconds kills the command when it runs long; default 10.
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+}
+
+// validate checks one hook entry.
+func (c *ExecHookConfig) validate() error {
+	if c.Command == "" {
+		return fmt.Errorf("exec_hooks: entry has no command")
+	}
+	if c.TimeoutSeconds <= 0 {
+		c.TimeoutSeconds = 10
+	}
+	return nil
+}
+
+// wants reports whether the hook fires for an event type.
+func (c *ExecHookConfig) wants(evType string) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, t := range c.Events {
+		if t == evType {
+			return true
+		}
+	}
+	return false
+}
+
+// execHook is the runtime for one configured hook.
+type execHook struct {
+	cfg  *ExecHookConfig
+	busy chan struct{}
+}
+
+// startExecHooks subscribes the configured hooks to the event bus.
+func startExecHooks(cfg *Config, r *Reflector) {
+	if len(cfg.ExecHooks) == 0 {
+		return
+	}
+	hooks := make([]*execHook, len(cfg.ExecHooks))
+	for i := range cfg.ExecHooks {
+		hooks[i] = &execHook{cfg: &cfg.ExecHooks[i], busy: make(chan struct{}, 1)}
+	}
+	ch, _ := r.events.subscribe()
+	go func() {
+		for ev := range ch {
+			for _, h := range hooks {
+				if !h.cfg.wants(ev.Type) {
+					continue
+				}
+				select {
+				case h.busy <- struct{}{}:
+					go func(h *execHook, ev Event) {
+						defer func() { <-h.busy }()
+						h.run(ev)
+					}(h, ev)
+				default:
+					metrics.Inc("mdns_exec_hook_skipped_total", Labels{"command": h.cfg.Command})
+				}
+			}
+		}
+	}()
+	log.Printf("exec hooks: %d command(s) attached to the event bus", len(hooks))
+}
+
+// run executes the hook once for one event.
+func (h *execHook) run(ev Event) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(h.cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.cfg.Command, h.cfg.Args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"MDNS_EVENT_TYPE="+ev.Type,
+		"MDNS_EVENT_IFACE="+ev.Iface,
+		"MDNS_EVENT_SRC_IP="+ev.SrcIP,
+		"MDNS_EVENT_RULE="+ev.Rule,
+		"MDNS_EVENT_SUMMARY="+ev.Summary,
+	)
+	out, err := cmd.CombinedOutput()
+	result := "ok"
+	if err != nil {
+		result = "error"
+		log.Printf("exec hook %s: %v (%s)", h.cfg.Command, err, bytes.TrimSpace(out))
+	}
+	metrics.Inc("mdns_exec_hook_runs_total", Labels{"command": h.cfg.Command, "result": result})
+}
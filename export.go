@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportConfig periodically writes the full inventory to a file, for
+// ingestion into CMDBs and asset management tooling.
+type ExportConfig struct {
+	// Path of the snapshot file; the extension does not matter, Format
+	// decides the encoding.
+	Path string `yaml:"path"`
+	// Format is "json" (default) or "csv".
+	Format string `yaml:"format"`
+	// Interval between snapshots in seconds; defaults to 300.
+	Interval int `yaml:"interval"`
+}
+
+func (e *ExportConfig) compile() error {
+	switch e.Format {
+	case "", "json", "csv":
+		return nil
+	}
+	return fmt.Errorf("export: format must be json or csv, got %q", e.Format)
+}
+
+// startExporter launches the periodic snapshot writer if configured.
+func startExporter(cfg *Config, inv *inventory) {
+	if cfg.Export.Path == "" {
+		return
+	}
+	interval := time.Duration(cfg.Export.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	go func() {
+		for range time.Tick(interval) {
+			if err := writeSnapshot(&cfg.Export, inv.snapshot()); err != nil {
+				log.Printf("inventory export: %v", err)
+			}
+		}
+	}()
+	log.Printf("exporting inventory to %s every %s", cfg.Export.Path, interval)
+}
+
+// writeSnapshot writes the entries atomically (temp file plus rename) so
+// consumers never read a half-written snapshot.
+func writeSnapshot(cfg *ExportConfig, entries []inventoryEntry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(cfg.Path), ".mdns-reflector-export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	switch cfg.Format {
+	case "csv":
+		err = writeCSV(tmp, entries)
+	default:
+		enc := json.NewEncoder(tmp)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cfg.Path)
+}
+
+func writeCSV(f *os.File, entries []inventoryEntry) error {
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"instance", "service", "host", "port", "ips", "iface", "src_ip", "first_seen", "last_seen"}); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		rec := []string{
+			e.Instance, e.Service, e.Host, strconv.Itoa(int(e.Port)),
+			strings.Join(e.IPs, " "), e.Iface, e.SrcIP,
+			e.FirstSeen.Format(time.RFC3339), e.LastSeen.Format(time.RFC3339),
+		}
+		if err := w.Write(rec); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
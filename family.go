@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// AddressFamilyConfig translates address records in responses reflected
+// into a group whose segment is single-stack:
+//
+//   - "keep" (default): responses pass through unmodified
+//   - "strip-a": remove A records
+//   - "strip-aaaa": remove AAAA records
+//   - "prefer-a" / "prefer-aaaa": remove the other family's records only
+//     for names that also carry the preferred family, so single-stack
+//     hosts stay resolvable on a dual-stack segment that leans one way
+//   - "synthesize-aaaa": remove A records after synthesizing AAAA records
+//     from them using the configured NAT64 prefix, DNS64-style
+type AddressFamilyConfig struct {
+	Mode        string `yaml:"mode"`
+	NAT64Prefix string `yaml:"nat64_prefix"`
+
+	prefix net.IP
+}
+
+func (a *AddressFamilyConfig) compile() error {
+	switch a.Mode {
+	case "", "keep", "strip-a", "strip-aaaa", "prefer-a", "prefer-aaaa":
+	case "synthesize-aaaa":
+		if a.NAT64Prefix == "" {
+			return fmt.Errorf("address_family: synthesize-aaaa requires nat64_prefix")
+		}
+		ip, ipnet, err := net.ParseCIDR(a.NAT64Prefix)
+		if err != nil {
+			return fmt.Errorf("address_family: nat64_prefix %q: %w", a.NAT64Prefix, err)
+		}
+		if ones, bits := ipnet.Mask.Size(); bits != 128 || ones != 96 {
+			return fmt.Errorf("address_family: nat64_prefix must be an IPv6 /96, got %q", a.NAT64Prefix)
+		}
+		a.prefix = ip.To16()
+	default:
+		return fmt.Errorf("address_family: unknown mode %q", a.Mode)
+	}
+	return nil
+}
+
+func (a *AddressFamilyConfig) active() bool {
+	return a.Mode != "" && a.Mode != "keep"
+}
+
+// apply rewrites the record sections of msg according to the policy,
+// returning a modified copy and whether anything changed. The input message
+// is never mutated: other destination groups may need the original.
+func (a *AddressFamilyConfig) apply(msg *dns.Msg) (*dns.Msg, bool) {
+	changed := false
+	out := msg.Copy()
+	// The prefer modes only drop a family for names that carry the
+	// preferred one too, so take stock of who has what first.
+	hasA := make(map[string]bool)
+	hasAAAA := make(map[string]bool)
+	if a.Mode == "prefer-a" || a.Mode == "prefer-aaaa" {
+		for _, section := range [][]dns.RR{out.Answer, out.Extra} {
+			for _, rr := range section {
+				switch rr.(type) {
+				case *dns.A:
+					hasA[rr.Header().Name] = true
+				case *dns.AAAA:
+					hasAAAA[rr.Header().Name] = true
+				}
+			}
+		}
+	}
+	for _, section := range []*[]dns.RR{&out.Answer, &out.Extra} {
+		var kept []dns.RR
+		for _, rr := range *section {
+			switch rec := rr.(type) {
+			case *dns.A:
+				if a.Mode == "strip-a" {
+					changed = true
+					continue
+				}
+				if a.Mode == "prefer-aaaa" && hasAAAA[rec.Hdr.Name] {
+					changed = true
+					continue
+				}
+				if a.Mode == "synthesize-aaaa" {
+					kept = append(kept, a.synthesize(rec))
+					changed = true
+					continue
+				}
+			case *dns.AAAA:
+				if a.Mode == "strip-aaaa" {
+					changed = true
+					continue
+				}
+				if a.Mode == "prefer-a" && hasA[rec.Hdr.Name] {
+					changed = true
+					continue
+				}
+			}
+			kept = append(kept, rr)
+		}
+		*section = kept
+	}
+	return out, changed
+}
+
+// synthesize builds an AAAA record embedding the A record's address in the
+// NAT64 prefix (RFC 6052 /96 mapping).
+func (a *AddressFamilyConfig) synthesize(rec *dns.A) *dns.AAAA {
+	v6 := make(net.IP, net.IPv6len)
+	copy(v6, a.prefix)
+	copy(v6[12:], rec.A.To4())
+	hdr := rec.Hdr
+	hdr.Rrtype = dns.TypeAAAA
+	return &dns.AAAA{Hdr: hdr, AAAA: v6}
+}
+
+// familyWire returns the on-wire payload for a destination group, applying
+// its address-family policy to responses. Unaffected groups get the
+// original payload.
+func (r *Reflector) familyWire(pkt *packet, wire []byte, g *Group, cache map[string][]byte) []byte {
+	if g == nil || !g.AddressFamily.active() || !pkt.msg.Response {
+		return wire
+	}
+	if cached, ok := cache[g.Name]; ok {
+		return cached
+	}
+	msg, changed := g.AddressFamily.apply(pkt.msg)
+	out := wire
+	if changed {
+		packed, err := msg.Pack()
+		if err == nil {
+			out = packed
+			metrics.Inc("mdns_family_translations_total", Labels{"group": g.Name, "mode": g.AddressFamily.Mode})
+		}
+	}
+	cache[g.Name] = out
+	return out
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Fan-out guard. A wildcard rule that lands on a 40-VLAN trunk turns every
+// announcement into forty copies; a loop between two reflectors turns it
+// into an unbounded storm. Two independent brakes: a hard cap on how many
+// interfaces one packet may be forwarded to, and a rolling
+// packets-out:packets-in ratio that raises an alarm (and shows up as a
+// gauge) when reflection amplifies beyond what the policy plausibly
+// intends.
+
+// FanoutConfig bounds reflection amplification.
+type FanoutConfig struct {
+	// MaxDestinations caps the interfaces one packet is copied to;
+	// destinations beyond the cap are dropped and counted. Default 16,
+	// -1 disables the cap.
+	MaxDestinations int `yaml:"max_destinations"`
+	// AlarmRatio is the packets-out per packet-in ratio above which the
+	// amplification alarm fires. Default 8, 0 disables the alarm.
+	AlarmRatio float64 `yaml:"alarm_ratio"`
+}
+
+// compile applies defaults.
+func (c *FanoutConfig) compile() {
+	if c.MaxDestinations == 0 {
+		c.MaxDestinations = 16
+	}
+	if c.AlarmRatio == 0 {
+		c.AlarmRatio = 8
+	}
+}
+
+// fanoutGuard tracks the rolling in/out packet counts.
+type fanoutGuard struct {
+	r       *Reflector
+	mu      sync.Mutex
+	in      uint64
+	out     uint64
+	alarmed bool
+}
+
+func newFanoutGuard(r *Reflector) *fanoutGuard {
+	return &fanoutGuard{r: r}
+}
+
+// observeIn counts one received packet.
+func (f *fanoutGuard) observeIn() {
+	f.mu.Lock()
+	f.in++
+	f.mu.Unlock()
+}
+
+// observeOut counts one transmitted copy.
+func (f *fanoutGuard) observeOut() {
+	f.mu.Lock()
+	f.out++
+	f.mu.Unlock()
+}
+
+// cap truncates a destination list to the packet fan-out limit. The rule's
+// own max_fanout (when set) overrides the global cap.
+func (f *fanoutGuard) cap(dsts []string, ruleMax int, why string) []string {
+	limit := f.r.config().Fanout.MaxDestinations
+	if ruleMax > 0 {
+		limit = ruleMax
+	}
+	if limit < 0 || len(dsts) <= limit {
+		return dsts
+	}
+	metrics.Add("mdns_fanout_capped_total", Labels{"rule": why}, float64(len(dsts)-limit))
+	if f.r.config().Debug {
+		log.Printf("fan-out cap: %s limited to %d of %d destinations", why, limit, len(dsts))
+	}
+	return dsts[:limit]
+}
+
+// run recomputes the amplification ratio every interval. The alarm has
+// hysteresis: it fires once when the ratio crosses the threshold and
+// clears only after a full interval back under it.
+func (f *fanoutGuard) run() {
+	const interval = 30 * time.Second
+	// Below this many received packets per interval the ratio is noise.
+	const minSample = 20
+	for range time.Tick(interval) {
+		f.mu.Lock()
+		in, out := f.in, f.out
+		f.in, f.out = 0, 0
+		f.mu.Unlock()
+		if in < minSample {
+			continue
+		}
+		ratio := float64(out) / float64(in)
+		metrics.Set("mdns_amplification_ratio", nil, ratio)
+		threshold := f.r.config().Fanout.AlarmRatio
+		if threshold <= 0 {
+			continue
+		}
+		switch {
+		case ratio > threshold && !f.alarmed:
+			f.alarmed = true
+			metrics.Inc("mdns_amplification_alarms_total", nil)
+			log.Printf("amplification alarm: %.1f packets out per packet in (threshold %.1f)", ratio, threshold)
+			f.r.events.publish(Event{
+				Type:    "alarm",
+				Summary: "amplification ratio exceeded threshold",
+			})
+		case ratio <= threshold && f.alarmed:
+			f.alarmed = false
+			log.Printf("amplification alarm cleared: ratio %.1f", ratio)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import "sync"
+
+// The hot path runs on MIPS/ARM router CPUs, so the receive loop reuses
+// payload buffers through a pool and decides as much as possible straight
+// from the wire bytes before paying for a full message unpack. Everything
+// in this file is allocation-free; fastpath_test.go gates that with an
+// allocation assertion.
+
+// maxPacketSize is the default receive buffer size; larger than any legal
+// mDNS datagram. Low-memory mode shrinks it to one MTU before startup.
+const maxPacketSize = 9000
+
+var packetBufSize = maxPacketSize
+
+var bufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, packetBufSize)
+		return &b
+	},
+}
+
+func getBuf() *[]byte  { return bufPool.Get().(*[]byte) }
+func putBuf(b *[]byte) { bufPool.Put(b) }
+
+// wireIsResponse reads the QR bit from a raw DNS header. ok is false when
+// the payload is too short to be a DNS message.
+func wireIsResponse(payload []byte) (isResponse, ok bool) {
+	if len(payload) < 12 {
+		return false, false
+	}
+	return payload[2]&0x80 != 0, true
+}
+
+// wireMentionsService reports whether any question or answer name in the
+// raw message contains the given service labels (e.g. "_ipp" "._tcp"
+// rendered as "_ipp._tcp"). Patterns must be lowercase. The scan walks
+// question and resource-record names with bounded compression-pointer
+// jumps and never allocates.
+func wireMentionsService(payload []byte, patterns [][]byte) bool {
+	if len(payload) < 12 || len(patterns) == 0 {
+		return false
+	}
+	qd := int(payload[4])<<8 | int(payload[5])
+	an := int(payload[6])<<8 | int(payload[7])
+	var name [256]byte
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		n := renderName(payload, off, name[:0])
+		if n == nil {
+			return false
+		}
+		if matchAny(n, patterns) {
+			return true
+		}
+		off = skipName(payload, off)
+		if off < 0 || off+4 > len(payload) {
+			return false
+		}
+		off += 4
+	}
+	for i := 0; i < an; i++ {
+		n := renderName(payload, off, name[:0])
+		if n == nil {
+			return false
+		}
+		if matchAny(n, patterns) {
+			return true
+		}
+		off = skipName(payload, off)
+		if off < 0 || off+10 > len(payload) {
+			return false
+		}
+		rdlen := int(payload[off+8])<<8 | int(payload[off+9])
+		off += 10 + rdlen
+		if off > len(payload) {
+			return false
+		}
+	}
+	return false
+}
+
+// renderName appends the lowercase dotted name at off into dst, following
+// compression pointers, and returns the result or nil on malformed input.
+func renderName(payload []byte, off int, dst []byte) []byte {
+	jumps := 0
+	for {
+		if off >= len(payload) || jumps > 16 || len(dst) > 255 {
+			return nil
+		}
+		l := int(payload[off])
+		switch {
+		case l == 0:
+			return dst
+		case l&0xc0 == 0xc0:
+			if off+1 >= len(payload) {
+				return nil
+			}
+			off = (l&0x3f)<<8 | int(payload[off+1])
+			jumps++
+		case l&0xc0 != 0:
+			return nil
+		default:
+			if off+1+l > len(payload) {
+				return nil
+			}
+			if len(dst) > 0 {
+				dst = append(dst, '.')
+			}
+			for _, c := range payload[off+1 : off+1+l] {
+				if c >= 'A' && c <= 'Z' {
+					c += 'a' - 'A'
+				}
+				dst = append(dst, c)
+			}
+			off += 1 + l
+		}
+	}
+}
+
+// skipName advances past the (possibly compressed) name at off, returning
+// the new offset or -1 on malformed input.
+func skipName(payload []byte, off int) int {
+	for {
+		if off >= len(payload) {
+			return -1
+		}
+		l := int(payload[off])
+		switch {
+		case l == 0:
+			return off + 1
+		case l&0xc0 == 0xc0:
+			return off + 2
+		case l&0xc0 != 0:
+			return -1
+		default:
+			off += 1 + l
+		}
+	}
+}
+
+// matchAny reports whether name contains one of the patterns.
+func matchAny(name []byte, patterns [][]byte) bool {
+	for _, p := range patterns {
+		if containsBytes(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsBytes(haystack, needle []byte) bool {
+	if len(needle) == 0 || len(needle) > len(haystack) {
+		return false
+	}
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		j := 0
+		for ; j < len(needle); j++ {
+			if haystack[i+j] != needle[j] {
+				break
+			}
+		}
+		if j == len(needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefilter is the compiled per-group query pre-check.
+type prefilter struct {
+	patterns [][]byte
+	labels   Labels // prebuilt once per group
+}
+
+// buildPrefilters compiles, for each group whose rules all filter on
+// services, the union of those services as lowercase byte patterns. Groups
+// with an unfiltered rule get no prefilter.
+func buildPrefilters(cfg *Config) map[string]*prefilter {
+	out := make(map[string]*prefilter)
+	for gi := range cfg.Groups {
+		g := &cfg.Groups[gi]
+		var patterns [][]byte
+		usable := false
+		for i := range cfg.Rules {
+			rule := &cfg.Rules[i]
+			if rule.From != g.Name {
+				continue
+			}
+			usable = true
+			if len(rule.Filter.services) == 0 {
+				usable = false
+				break
+			}
+			for svc := range rule.Filter.services {
+				patterns = append(patterns, []byte(svc))
+			}
+		}
+		if usable && len(patterns) > 0 {
+			out[g.Name] = &prefilter{
+				patterns: patterns,
+				labels:   Labels{"group": g.Name},
+			}
+		}
+	}
+	return out
+}
+
+// prefilterDrops reports whether a query can be discarded straight from
+// the wire bytes, before the full (allocating) unpack. It never fires for
+// responses, for configs with client overrides, or while a shadow config
+// is loaded, since those paths need the parsed message.
+func (r *Reflector) prefilterDrops(payload []byte, group *Group) bool {
+	r.mu.Lock()
+	pf := r.queryPrefilter[group.Name]
+	r.mu.Unlock()
+	if pf == nil || len(r.config().Clients) > 0 {
+		return false
+	}
+	isResponse, ok := wireIsResponse(payload)
+	if !ok || isResponse {
+		return false
+	}
+	r.shadow.mu.Lock()
+	shadowLoaded := r.shadow.cfg != nil
+	r.shadow.mu.Unlock()
+	if shadowLoaded {
+		return false
+	}
+	if r.companion.active() {
+		// Expected follow-ups (plain A/AAAA lookups) never mention a
+		// service; the prefilter must stand down to let them through.
+		return false
+	}
+	if r.learning.active() {
+		// Learning mode must see traffic the current rules would never
+		// reflect; dropping it at the wire would leave those services
+		// invisible to the suggested config.
+		return false
+	}
+	if wireMentionsService(payload, pf.patterns) {
+		return false
+	}
+	metrics.Inc("mdns_prefilter_drops_total", pf.labels)
+	return true
+}
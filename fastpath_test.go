@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func packQuery(t testing.TB, name string) []byte {
+	t.Helper()
+	msg := new(dns.Msg)
+	msg.Question = append(msg.Question, dns.Question{
+		Name: name, Qtype: dns.TypePTR, Qclass: dns.ClassINET,
+	})
+	wire, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wire
+}
+
+func TestWireMentionsService(t *testing.T) {
+	patterns := [][]byte{[]byte("_airplay._tcp"), []byte("_ipp._tcp")}
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"_airplay._tcp.local.", true},
+		{"_AirPlay._TCP.local.", true}, // case-insensitive
+		{"_ipp._tcp.local.", true},
+		{"_ssh._tcp.local.", false},
+		{"plain.local.", false},
+	}
+	for _, c := range cases {
+		wire := packQuery(t, c.name)
+		if got := wireMentionsService(wire, patterns); got != c.want {
+			t.Errorf("wireMentionsService(%s) = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// The wire scanner is the gate that keeps non-matching traffic off the
+// allocating unpack path; it must itself stay allocation-free.
+func TestFastScanZeroAlloc(t *testing.T) {
+	wire := packQuery(t, "_googlecast._tcp.local.")
+	patterns := [][]byte{[]byte("_airplay._tcp"), []byte("_ipp._tcp")}
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, ok := wireIsResponse(wire); !ok {
+			t.Fatal("header scan failed")
+		}
+		wireMentionsService(wire, patterns)
+	})
+	if allocs != 0 {
+		t.Fatalf("fast scan allocated %.0f times per run, want 0", allocs)
+	}
+}
+
+func BenchmarkHappyPathScan(b *testing.B) {
+	wire := packQuery(b, "_googlecast._tcp.local.")
+	patterns := [][]byte{[]byte("_airplay._tcp"), []byte("_googlecast._tcp")}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		wireIsResponse(wire)
+		if !wireMentionsService(wire, patterns) {
+			b.Fatal("expected match")
+		}
+	}
+}
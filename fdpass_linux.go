@@ -0,0 +1,108 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Socket handoff across restarts via the systemd fd store. With
+// FileDescriptorStoreMax= set on the unit, the running daemon pushes its
+// mDNS sockets to the manager (FDSTORE=1 over $NOTIFY_SOCKET, one
+// SCM_RIGHTS message per VRF socket) and the replacement process receives
+// them back through the sd_listen_fds protocol — no packet is lost while
+// the binary is swapped.
+
+// listenFDsStart is the first inherited descriptor under sd_listen_fds.
+const listenFDsStart = 3
+
+var (
+	inheritOnce    sync.Once
+	inheritedFiles map[string]*os.File
+)
+
+// inheritedFDs parses the sd_listen_fds environment once, keyed by
+// FDNAME. The variables are cleared so child processes do not misread
+// them.
+func inheritedFDs() map[string]*os.File {
+	inheritOnce.Do(func() {
+		inheritedFiles = make(map[string]*os.File)
+		pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+		if err != nil || pid != os.Getpid() {
+			return
+		}
+		n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		for i := 0; i < n; i++ {
+			fd := listenFDsStart + i
+			name := ""
+			if i < len(names) {
+				name = names[i]
+			}
+			unix.CloseOnExec(fd)
+			inheritedFiles[name] = os.NewFile(uintptr(fd), name)
+		}
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	})
+	return inheritedFiles
+}
+
+// InheritedConn adopts a stored socket by fd-store name, or returns nil
+// when none was passed in.
+func (nativeSockOps) InheritedConn(name string) *net.UDPConn {
+	f := inheritedFDs()[name]
+	if f == nil {
+		return nil
+	}
+	pc, err := net.FilePacketConn(f)
+	f.Close()
+	if err != nil {
+		return nil
+	}
+	uc, ok := pc.(*net.UDPConn)
+	if !ok {
+		pc.Close()
+		return nil
+	}
+	return uc
+}
+
+// StoreConn pushes one socket into the manager's fd store. A missing
+// NOTIFY_SOCKET (not running under systemd) is not an error.
+func (nativeSockOps) StoreConn(name string, uc *net.UDPConn) error {
+	target := os.Getenv("NOTIFY_SOCKET")
+	if target == "" {
+		return nil
+	}
+	if target[0] == '@' {
+		// Abstract-namespace address.
+		target = "\x00" + target[1:]
+	}
+	sc, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := sc.Control(func(fd uintptr) {
+		sock, err := unix.Socket(unix.AF_UNIX, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			serr = err
+			return
+		}
+		defer unix.Close(sock)
+		rights := unix.UnixRights(int(fd))
+		msg := []byte("FDSTORE=1\nFDNAME=" + name)
+		serr = unix.Sendmsg(sock, msg, rights, &unix.SockaddrUnix{Name: target}, 0)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
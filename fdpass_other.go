@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+// InheritedConn returns nil: the systemd fd store is a Linux facility.
+func (nativeSockOps) InheritedConn(name string) *net.UDPConn {
+	return nil
+}
+
+// StoreConn is a no-op where there is no systemd manager to store into.
+func (nativeSockOps) StoreConn(name string, uc *net.UDPConn) error {
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// fdName is the fd-store name for one VRF's mDNS socket.
+func fdName(vrf string) string {
+	if vrf == "" {
+		return "mdns"
+	}
+	return "mdns-" + vrf
+}
+
+// startFDStore pushes every open mDNS socket into the systemd fd store
+// right after startup, so a later binary replacement inherits them and no
+// packets are lost during the swap. Does nothing outside systemd.
+func startFDStore(r *Reflector) {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	r.mu.Lock()
+	socks := make(map[string]*vrfSocket, len(r.socks))
+	for vrf, s := range r.socks {
+		socks[vrf] = s
+	}
+	r.mu.Unlock()
+	for vrf, s := range socks {
+		if err := sys.StoreConn(fdName(vrf), s.uc); err != nil {
+			log.Printf("fd store: vrf %q: %v", vrf, err)
+		} else {
+			log.Printf("fd store: socket for vrf %q stored for handoff", vrf)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Filter decides whether a packet matched by a rule is actually forwarded.
+// All configured criteria must pass; an empty criterion matches everything.
+type Filter struct {
+	// Types restricts the packet kind. "query" and "response" match
+	// broadly; the finer classes "probe", "announcement", "goodbye" and
+	// "solicited-response" match exactly, so a rule can reflect solicited
+	// responses and goodbyes but never gratuitous announcements.
+	Types []string `yaml:"types"`
+	// AllowedServices lists service types (e.g. _airplay._tcp) the packet
+	// must mention in a question or answer.
+	AllowedServices []string `yaml:"allowed_services"`
+	// Profiles expand to the service lists of well-known applications; see
+	// profile.go. Expanded into AllowedServices at config load.
+	Profiles []string `yaml:"profiles"`
+	// AllowedIPs lists sources allowed through this rule: literal IPs,
+	// CIDR prefixes (192.168.19.0/24), or anything else is treated as a
+	// .local hostname and resolved (and re-resolved as devices renew
+	// leases) against addresses learned from live traffic.
+	AllowedIPs []string `yaml:"allowed_ips"`
+	// AllowedMACs lists source MAC addresses allowed through this rule.
+	// The packet's source IP is resolved through the kernel neighbor
+	// table, so the filter follows the device across DHCP lease changes.
+	AllowedMACs []string `yaml:"allowed_macs"`
+	// DeniedServices and DeniedIPs invert the allowlists: a packet that
+	// mentions a denied service, or comes from a denied IP or prefix, is
+	// dropped even when everything else matches. They let a rule say
+	// "everything except _ssh._tcp" without enumerating the world.
+	DeniedServices []string `yaml:"denied_services"`
+	DeniedIPs      []string `yaml:"denied_ips"`
+
+	services        map[string]bool
+	denied          map[string]bool
+	allowedAddrs    []netip.Addr
+	allowedPrefixes []netip.Prefix
+	deniedAddrs     []netip.Addr
+	deniedPrefixes  []netip.Prefix
+	allowedHosts    []string
+	allowedMACs     []string
+}
+
+// compile validates the filter and precomputes the service lookup set,
+// including profile expansion.
+func (f *Filter) compile() error {
+	for _, t := range f.Types {
+		switch t {
+		case "query", "response", "probe", "announcement", "goodbye", "solicited-response":
+		default:
+			return fmt.Errorf("unknown packet type %q in filter", t)
+		}
+	}
+	f.services = make(map[string]bool)
+	for _, s := range f.AllowedServices {
+		vetServiceType(s, "allowed_services")
+		f.services[normalizeService(s)] = true
+	}
+	for _, p := range f.Profiles {
+		svcs, ok := profiles[p]
+		if !ok {
+			return fmt.Errorf("unknown profile %q (available: %s)", p, strings.Join(profileNames(), ", "))
+		}
+		for _, s := range svcs {
+			f.services[normalizeService(s)] = true
+		}
+	}
+	f.denied = make(map[string]bool)
+	for _, s := range f.DeniedServices {
+		vetServiceType(s, "denied_services")
+		f.denied[normalizeService(s)] = true
+	}
+	f.allowedAddrs = nil
+	f.allowedPrefixes = nil
+	f.allowedHosts = nil
+	for _, entry := range f.AllowedIPs {
+		if strings.Contains(entry, "/") {
+			pfx, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return fmt.Errorf("bad prefix %q in allowed_ips: %w", entry, err)
+			}
+			f.allowedPrefixes = append(f.allowedPrefixes, pfx.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			f.allowedAddrs = append(f.allowedAddrs, addr.Unmap())
+		} else {
+			f.allowedHosts = append(f.allowedHosts, normalizeHostname(entry))
+		}
+	}
+	f.deniedAddrs = nil
+	f.deniedPrefixes = nil
+	for _, entry := range f.DeniedIPs {
+		if strings.Contains(entry, "/") {
+			pfx, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return fmt.Errorf("bad prefix %q in denied_ips: %w", entry, err)
+			}
+			f.deniedPrefixes = append(f.deniedPrefixes, pfx.Masked())
+		} else {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return fmt.Errorf("bad address %q in denied_ips: %w", entry, err)
+			}
+			f.deniedAddrs = append(f.deniedAddrs, addr.Unmap())
+		}
+	}
+	f.allowedMACs = nil
+	for _, entry := range f.AllowedMACs {
+		hw, err := net.ParseMAC(entry)
+		if err != nil {
+			return fmt.Errorf("bad mac %q in allowed_macs: %w", entry, err)
+		}
+		f.allowedMACs = append(f.allowedMACs, hw.String())
+	}
+	return nil
+}
+
+// match reports whether pkt passes the filter.
+func (f *Filter) match(pkt *packet) bool {
+	if len(f.Types) > 0 {
+		class := pkt.class()
+		ok := false
+		for _, t := range f.Types {
+			if t == class ||
+				(t == "query" && !pkt.msg.Response) ||
+				(t == "response" && pkt.msg.Response) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(f.denied) > 0 {
+		for _, s := range pkt.services() {
+			if f.denied[s] {
+				return false
+			}
+		}
+	}
+	if len(f.services) > 0 {
+		ok := false
+		for _, s := range pkt.services() {
+			if f.services[s] {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(f.deniedAddrs) > 0 || len(f.deniedPrefixes) > 0 {
+		if addr, ok := netip.AddrFromSlice(pkt.src.IP); ok {
+			addr = addr.Unmap()
+			for _, d := range f.deniedAddrs {
+				if d == addr {
+					return false
+				}
+			}
+			for _, pfx := range f.deniedPrefixes {
+				if pfx.Contains(addr) {
+					return false
+				}
+			}
+		}
+	}
+	if len(f.AllowedIPs) > 0 {
+		ok := false
+		srcAddr, haveAddr := netip.AddrFromSlice(pkt.src.IP)
+		if haveAddr {
+			srcAddr = srcAddr.Unmap()
+		}
+		for _, addr := range f.allowedAddrs {
+			if haveAddr && addr == srcAddr {
+				ok = true
+				break
+			}
+		}
+		for _, pfx := range f.allowedPrefixes {
+			if ok {
+				break
+			}
+			ok = haveAddr && pfx.Contains(srcAddr)
+		}
+		src := pkt.src.IP.String()
+		for _, host := range f.allowedHosts {
+			if ok {
+				break
+			}
+			ok = localHosts.contains(host, src)
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(f.allowedMACs) > 0 {
+		mac := lookupMAC(pkt.src.IP)
+		ok := false
+		for _, want := range f.allowedMACs {
+			if mac != "" && strings.EqualFold(mac, want) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchQuestion reports whether one question passes the filter's service
+// terms; filters without service terms match every question. Packet-level
+// terms (types, source addresses) are not re-checked here.
+func (f *Filter) matchQuestion(q dns.Question) bool {
+	svc := serviceOfName(q.Name)
+	if len(f.denied) > 0 && svc != "" && f.denied[svc] {
+		return false
+	}
+	if len(f.services) > 0 && !f.services[svc] {
+		return false
+	}
+	return true
+}
+
+// normalizeService lowercases a service type and trims the .local suffix
+// and trailing dot so config entries and wire names compare equal:
+// "_airplay._tcp", "_AirPlay._tcp." and "_airplay._tcp.local." all
+// normalize to the same string.
+func normalizeService(s string) string {
+	s = strings.ToLower(strings.TrimSuffix(s, "."))
+	s = strings.TrimSuffix(s, ".local")
+	return s
+}
+
+// vetServiceType logs likely typos in a configured service string. These
+// are warnings, not errors: unusual but legal types exist, and a config
+// that worked yesterday must keep loading. context names the config
+// location for the log line.
+func vetServiceType(s, context string) {
+	n := normalizeService(s)
+	if !strings.HasPrefix(n, "_") {
+		log.Printf("config: %s: service %q has no leading underscore; did you mean %q?", context, s, "_"+n)
+		return
+	}
+	if !strings.HasSuffix(n, "._tcp") && !strings.HasSuffix(n, "._udp") {
+		log.Printf("config: %s: service %q does not end in ._tcp or ._udp, which mDNS service types almost always do", context, s)
+	}
+}
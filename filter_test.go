@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// packetFrom builds a minimal parsed query from the given source IP.
+func packetFrom(t *testing.T, ip string) *packet {
+	t.Helper()
+	msg := new(dns.Msg)
+	msg.SetQuestion("_ipp._tcp.local.", dns.TypePTR)
+	raw, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkt, err := parsePacket(raw, &net.UDPAddr{IP: net.ParseIP(ip)}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkt
+}
+
+func TestAllowedIPsCIDR(t *testing.T) {
+	f := &Filter{AllowedIPs: []string{"192.168.19.0/24", "10.0.0.5"}}
+	if err := f.compile(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.168.19.1", true},
+		{"192.168.19.254", true},
+		{"192.168.20.1", false},
+		{"10.0.0.5", true},
+		{"10.0.0.6", false},
+	}
+	for _, c := range cases {
+		if got := f.match(packetFrom(t, c.ip)); got != c.want {
+			t.Errorf("source %s: match = %v, want %v", c.ip, got, c.want)
+		}
+	}
+}
+
+func TestDeniedServicesAndIPs(t *testing.T) {
+	f := &Filter{
+		DeniedServices: []string{"_ssh._tcp"},
+		DeniedIPs:      []string{"192.168.19.0/24"},
+	}
+	if err := f.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if f.match(packetFrom(t, "192.168.19.9")) {
+		t.Error("denied prefix matched")
+	}
+	if !f.match(packetFrom(t, "192.168.20.9")) {
+		t.Error("unlisted source blocked")
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("_ssh._tcp.local.", dns.TypePTR)
+	raw, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkt, err := parsePacket(raw, &net.UDPAddr{IP: net.ParseIP("192.168.20.9")}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.match(pkt) {
+		t.Error("denied service matched")
+	}
+}
+
+func TestAllowedIPsRejectsBadPrefix(t *testing.T) {
+	f := &Filter{AllowedIPs: []string{"192.168.19.0/33"}}
+	if err := f.compile(); err == nil {
+		t.Fatal("expected error for /33 prefix")
+	}
+}
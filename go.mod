@@ -0,0 +1,15 @@
+module github.com/grooverlabs/mdns-reflector
+
+go 1.21
+
+require (
+	github.com/miekg/dns v1.1.58
+	golang.org/x/net v0.20.0
+	golang.org/x/sys v0.16.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/mod v0.14.0 // indirect
+	golang.org/x/tools v0.17.0 // indirect
+)
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Goodbye flood protection. A TTL-0 record wipes the name from every
+// cache that hears it, and the reflector repeats it network-wide — so a
+// single buggy or malicious device spraying goodbyes for other hosts'
+// records can blank the whole network's service browsers. Two defenses:
+// a goodbye is only reflected for records its sender actually announced
+// earlier, and each source gets a bounded goodbye rate.
+
+// goodbyeRateLimit is the per-source goodbyes allowed per minute; a
+// device legitimately shutting down says goodbye to a handful of records.
+const goodbyeRateLimit = 20
+
+// goodbyeOwnersCap bounds the announcement memory.
+const goodbyeOwnersCap = 65536
+
+type goodbyeGuard struct {
+	r  *Reflector
+	mu sync.Mutex
+	// announcedBy maps a lowercased record owner name to the source IP
+	// that last announced it with a live TTL.
+	announcedBy map[string]string
+	// sent counts goodbyes per source IP in the current window.
+	sent        map[string]int
+	windowStart time.Time
+}
+
+func newGoodbyeGuard(r *Reflector) *goodbyeGuard {
+	return &goodbyeGuard{
+		r:           r,
+		announcedBy: make(map[string]string),
+		sent:        make(map[string]int),
+	}
+}
+
+// observe records live announcements so later goodbyes can be checked
+// against who owns each name.
+func (g *goodbyeGuard) observe(pkt *packet) {
+	if !pkt.msg.Response {
+		return
+	}
+	src := pkt.src.IP.String()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, rr := range pkt.msg.Answer {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeOPT || hdr.Ttl == 0 {
+			continue
+		}
+		if len(g.announcedBy) >= goodbyeOwnersCap {
+			g.announcedBy = make(map[string]string)
+		}
+		g.announcedBy[strings.ToLower(hdr.Name)] = src
+	}
+}
+
+// allow decides whether a goodbye packet may be reflected. It is denied
+// when the source exceeds its goodbye rate, or when any TTL-0 record
+// names something a different source announced.
+func (g *goodbyeGuard) allow(pkt *packet, srcIface string) bool {
+	src := pkt.src.IP.String()
+	now := g.r.clk.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.Sub(g.windowStart) >= time.Minute {
+		g.windowStart = now
+		g.sent = make(map[string]int)
+	}
+	g.sent[src]++
+	if g.sent[src] > goodbyeRateLimit {
+		metrics.Inc("mdns_goodbye_ratelimited_total", Labels{"iface": srcIface})
+		return false
+	}
+	for _, rr := range pkt.msg.Answer {
+		hdr := rr.Header()
+		if hdr.Ttl != 0 {
+			continue
+		}
+		owner, known := g.announcedBy[strings.ToLower(hdr.Name)]
+		if known && owner != src {
+			metrics.Inc("mdns_goodbye_spoofed_total", Labels{"iface": srcIface})
+			log.Printf("dropping goodbye from %s on %s: %s was announced by %s",
+				src, srcIface, hdr.Name, owner)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// Home Assistant integration. Run as an add-on (or anywhere a broker is
+// reachable), the reflector announces itself over MQTT discovery: a
+// binary sensor reports health, a sensor carries the inventory size with
+// the full inventory as an attribute payload, and a switch pauses and
+// resumes reflection from the HA dashboard. The MQTT 3.1.1 subset needed
+// — CONNECT, PUBLISH QoS 0, SUBSCRIBE and PINGREQ — is small enough to
+// speak directly, in the same spirit as the AgentX and TZSP encoders.
+
+// HomeAssistantConfig points at the MQTT broker.
+type HomeAssistantConfig struct {
+	// Broker is the host:port of the MQTT broker; empty disables the
+	// integration.
+	Broker   string `yaml:"broker"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// DiscoveryPrefix is HA's discovery topic prefix; default
+	// "homeassistant".
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+	// IntervalSeconds is the state publish period; default 60.
+	IntervalSeconds int `yaml:"interval_seconds"`
+}
+
+// validate applies defaults when enabled.
+func (c *HomeAssistantConfig) validate() error {
+	if c.Broker == "" {
+		return nil
+	}
+	if c.DiscoveryPrefix == "" {
+		c.DiscoveryPrefix = "homeassistant"
+	}
+	if c.IntervalSeconds <= 0 {
+		c.IntervalSeconds = 60
+	}
+	return nil
+}
+
+// hassStateTopic and friends are the topics this instance owns.
+const (
+	hassStateTopic   = "mdns-reflector/state"
+	hassHealthTopic  = "mdns-reflector/health"
+	hassPauseTopic   = "mdns-reflector/pause/state"
+	hassCommandTopic = "mdns-reflector/pause/set"
+)
+
+// hassBridge is the MQTT session.
+type hassBridge struct {
+	cfg  *HomeAssistantConfig
+	r    *Reflector
+	conn net.Conn
+}
+
+// startHomeAssistant connects to the broker and keeps the session alive.
+func startHomeAssistant(cfg *Config, r *Reflector) {
+	if cfg.HomeAssistant.Broker == "" {
+		return
+	}
+	h := &hassBridge{cfg: &cfg.HomeAssistant, r: r}
+	go h.run()
+	log.Printf("home assistant: publishing to %s every %ds", cfg.HomeAssistant.Broker, cfg.HomeAssistant.IntervalSeconds)
+}
+
+func (h *hassBridge) run() {
+	for {
+		if err := h.session(); err != nil {
+			log.Printf("home assistant: %v", err)
+			metrics.Inc("mdns_hass_errors_total", nil)
+		}
+		time.Sleep(30 * time.Second)
+	}
+}
+
+// session runs one broker connection: announce, subscribe, then publish
+// state on a timer and apply pause commands until the connection dies.
+func (h *hassBridge) session() error {
+	conn, err := net.DialTimeout("tcp", h.cfg.Broker, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	h.conn = conn
+	defer conn.Close()
+	if err := h.connect(); err != nil {
+		return err
+	}
+	if err := h.announce(); err != nil {
+		return err
+	}
+	if err := h.subscribe(hassCommandTopic); err != nil {
+		return err
+	}
+	if err := h.publishState(); err != nil {
+		return err
+	}
+	interval := time.Duration(h.cfg.IntervalSeconds) * time.Second
+	// The read loop owns the connection; the writer side keeps state
+	// fresh and doubles as the keepalive.
+	errc := make(chan error, 1)
+	go func() { errc <- h.readLoop() }()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case <-tick.C:
+			if err := h.publishState(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// announce publishes the retained MQTT discovery configs.
+func (h *hassBridge) announce() error {
+	device := map[string]any{
+		"identifiers":  []string{"mdns-reflector"},
+		"name":         "mDNS Reflector",
+		"manufacturer": "grooverlabs",
+		"sw_version":   version,
+	}
+	entities := []struct {
+		kind, id string
+		config   map[string]any
+	}{
+		{"binary_sensor", "health", map[string]any{
+			"name":         "mDNS Reflector Health",
+			"state_topic":  hassHealthTopic,
+			"device_class": "problem",
+			"payload_on":   "degraded",
+			"payload_off":  "ok",
+			"unique_id":    "mdns-reflector-health",
+			"device":       device,
+		}},
+		{"sensor", "inventory", map[string]any{
+			"name":                  "mDNS Inventory",
+			"state_topic":           hassStateTopic,
+			"value_template":        "{{ value_json.services }}",
+			"json_attributes_topic": hassStateTopic,
+			"unique_id":             "mdns-reflector-inventory",
+			"device":                device,
+		}},
+		{"switch", "pause", map[string]any{
+			"name":          "mDNS Reflection Paused",
+			"state_topic":   hassPauseTopic,
+			"command_topic": hassCommandTopic,
+			"payload_on":    "paused",
+			"payload_off":   "running",
+			"unique_id":     "mdns-reflector-pause",
+			"device":        device,
+		}},
+	}
+	for _, e := range entities {
+		topic := fmt.Sprintf("%s/%s/mdns-reflector/%s/config", h.cfg.DiscoveryPrefix, e.kind, e.id)
+		payload, err := json.Marshal(e.config)
+		if err != nil {
+			return err
+		}
+		if err := h.publish(topic, payload, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishState pushes the health, pause and inventory states.
+func (h *hassBridge) publishState() error {
+	health := "ok"
+	h.r.mu.Lock()
+	for _, st := range h.r.ifaceStates {
+		st.mu.Lock()
+		degraded := st.degraded
+		st.mu.Unlock()
+		if degraded {
+			health = "degraded"
+			break
+		}
+	}
+	h.r.mu.Unlock()
+	if err := h.publish(hassHealthTopic, []byte(health), false); err != nil {
+		return err
+	}
+	pause := "running"
+	if h.r.paused.Load() {
+		pause = "paused"
+	}
+	if err := h.publish(hassPauseTopic, []byte(pause), false); err != nil {
+		return err
+	}
+	inv := h.r.inv.snapshot()
+	state, err := json.Marshal(map[string]any{
+		"services":  len(inv),
+		"inventory": inv,
+	})
+	if err != nil {
+		return err
+	}
+	return h.publish(hassStateTopic, state, false)
+}
+
+// readLoop handles broker-to-client packets: pause commands and ping
+// responses; everything else is skipped by length.
+func (h *hassBridge) readLoop() error {
+	for {
+		ptype, body, err := h.readPacket()
+		if err != nil {
+			return err
+		}
+		if ptype != 0x30 { // PUBLISH QoS 0
+			continue
+		}
+		if len(body) < 2 {
+			continue
+		}
+		tlen := int(binary.BigEndian.Uint16(body))
+		if 2+tlen > len(body) {
+			continue
+		}
+		topic := string(body[2 : 2+tlen])
+		payload := string(body[2+tlen:])
+		if topic != hassCommandTopic {
+			continue
+		}
+		h.r.setPaused(payload == "paused")
+		if err := h.publishState(); err != nil {
+			return err
+		}
+	}
+}
+
+// --- minimal MQTT 3.1.1 encoding ---
+
+// mqttString appends a length-prefixed UTF-8 string.
+func mqttString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// mqttFrame prepends the fixed header with a varint remaining length.
+func mqttFrame(ptype byte, body []byte) []byte {
+	out := []byte{ptype}
+	n := len(body)
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		out = append(out, d)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+// connect sends CONNECT and waits for a clean CONNACK.
+func (h *hassBridge) connect() error {
+	var flags byte = 0x02 // clean session
+	if h.cfg.Username != "" {
+		flags |= 0x80
+	}
+	if h.cfg.Password != "" {
+		flags |= 0x40
+	}
+	body := mqttString(nil, "MQTT")
+	body = append(body, 4, flags)
+	keepalive := uint16(h.cfg.IntervalSeconds * 2)
+	body = binary.BigEndian.AppendUint16(body, keepalive)
+	body = mqttString(body, "mdns-reflector")
+	if h.cfg.Username != "" {
+		body = mqttString(body, h.cfg.Username)
+	}
+	if h.cfg.Password != "" {
+		body = mqttString(body, h.cfg.Password)
+	}
+	if _, err := h.conn.Write(mqttFrame(0x10, body)); err != nil {
+		return err
+	}
+	ptype, ack, err := h.readPacket()
+	if err != nil {
+		return err
+	}
+	if ptype&0xf0 != 0x20 || len(ack) != 2 || ack[1] != 0 {
+		return fmt.Errorf("broker refused connection")
+	}
+	return nil
+}
+
+// publish sends one QoS 0 message.
+func (h *hassBridge) publish(topic string, payload []byte, retain bool) error {
+	var ptype byte = 0x30
+	if retain {
+		ptype |= 0x01
+	}
+	body := mqttString(nil, topic)
+	body = append(body, payload...)
+	h.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := h.conn.Write(mqttFrame(ptype, body))
+	return err
+}
+
+// subscribe asks for one topic at QoS 0.
+func (h *hassBridge) subscribe(topic string) error {
+	body := binary.BigEndian.AppendUint16(nil, 1) // packet id
+	body = mqttString(body, topic)
+	body = append(body, 0) // QoS 0
+	if _, err := h.conn.Write(mqttFrame(0x82, body)); err != nil {
+		return err
+	}
+	ptype, _, err := h.readPacket()
+	if err != nil {
+		return err
+	}
+	if ptype&0xf0 != 0x90 {
+		return fmt.Errorf("broker refused subscription")
+	}
+	return nil
+}
+
+// readPacket reads one MQTT packet, returning its type byte and body.
+func (h *hassBridge) readPacket() (byte, []byte, error) {
+	var hdr [1]byte
+	if _, err := io.ReadFull(h.conn, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		var d [1]byte
+		if _, err := io.ReadFull(h.conn, d[:]); err != nil {
+			return 0, nil, err
+		}
+		n |= int(d[0]&0x7f) << shift
+		if d[0]&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, fmt.Errorf("bad remaining length")
+		}
+	}
+	if n > 1<<20 {
+		return 0, nil, fmt.Errorf("oversized packet (%d bytes)", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(h.conn, body); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], body, nil
+}
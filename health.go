@@ -0,0 +1,150 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// healthChecker periodically verifies end-to-end reflection per enabled
+// application profile: it sends a browse query on the configured user-side
+// group and expects a matching response to come back within the timeout.
+// The result is exported as the mdns_profile_healthy gauge.
+type healthChecker struct {
+	r        *Reflector
+	group    *Group
+	interval time.Duration
+	timeout  time.Duration
+
+	mu sync.Mutex
+	// lastResponse records when a response mentioning a profile's service
+	// was last observed, per profile name.
+	lastResponse map[string]time.Time
+	healthy      map[string]bool
+}
+
+// startHealthChecks builds the checker from config, covering every profile
+// referenced by a rule. Returns nil if health checks are not configured.
+func startHealthChecks(cfg *Config, r *Reflector) *healthChecker {
+	if cfg.HealthChecks.Group == "" {
+		return nil
+	}
+	g := cfg.group(cfg.HealthChecks.Group)
+	if g == nil {
+		log.Printf("health_checks: unknown group %q, checks disabled", cfg.HealthChecks.Group)
+		return nil
+	}
+	h := &healthChecker{
+		r:            r,
+		group:        g,
+		interval:     time.Duration(cfg.HealthChecks.Interval) * time.Second,
+		timeout:      time.Duration(cfg.HealthChecks.Timeout) * time.Second,
+		lastResponse: make(map[string]time.Time),
+		healthy:      make(map[string]bool),
+	}
+	if h.interval <= 0 {
+		h.interval = 60 * time.Second
+	}
+	if h.timeout <= 0 {
+		h.timeout = 3 * time.Second
+	}
+	go h.run()
+	return h
+}
+
+// enabledProfiles returns the union of profiles referenced by the rules.
+func enabledProfiles(cfg *Config) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, rule := range cfg.Rules {
+		for _, p := range rule.Filter.Profiles {
+			if !seen[p] {
+				seen[p] = true
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+func (h *healthChecker) run() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		for _, profile := range enabledProfiles(h.r.config()) {
+			h.check(profile)
+		}
+		<-ticker.C
+	}
+}
+
+// check probes one profile and updates its gauge.
+func (h *healthChecker) check(profile string) {
+	svcs := profiles[profile]
+	if len(svcs) == 0 {
+		return
+	}
+	probe := new(dns.Msg)
+	probe.Question = append(probe.Question, dns.Question{
+		Name:   svcs[0] + ".local.",
+		Qtype:  dns.TypePTR,
+		Qclass: dns.ClassINET,
+	})
+	wire, err := probe.Pack()
+	if err != nil {
+		log.Printf("health check %s: packing probe: %v", profile, err)
+		return
+	}
+	sent := time.Now()
+	for _, name := range h.group.Interfaces {
+		h.r.send(wire, name)
+	}
+	time.Sleep(h.timeout)
+
+	h.mu.Lock()
+	ok := h.lastResponse[profile].After(sent)
+	was, known := h.healthy[profile]
+	h.healthy[profile] = ok
+	h.mu.Unlock()
+
+	v := 0.0
+	if ok {
+		v = 1.0
+	}
+	metrics.Set("mdns_profile_healthy", Labels{"profile": profile}, v)
+	if known && was != ok {
+		if ok {
+			log.Printf("health check: profile %s recovered", profile)
+		} else {
+			log.Printf("ALERT: health check: profile %s is failing (no response within %s)", profile, h.timeout)
+		}
+	} else if !known && !ok {
+		log.Printf("ALERT: health check: profile %s is failing (no response within %s)", profile, h.timeout)
+	}
+}
+
+// observe is called from the packet path for every parsed response so the
+// checker can match probe answers without opening its own socket.
+func (h *healthChecker) observe(pkt *packet) {
+	if !pkt.msg.Response {
+		return
+	}
+	svcs := pkt.services()
+	if len(svcs) == 0 {
+		return
+	}
+	now := time.Now()
+	h.mu.Lock()
+	for name, list := range profiles {
+		for _, s := range list {
+			for _, got := range svcs {
+				if s == got {
+					h.lastResponse[name] = now
+				}
+			}
+		}
+	}
+	h.mu.Unlock()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Packet history. A small ring of the last N decoded packets per
+// interface answers "what just happened" after the fact, without running
+// a continuous capture next to the daemon.
+
+// HistoryConfig sizes the per-interface ring.
+type HistoryConfig struct {
+	// Size is the entries kept per interface; 0 disables history.
+	Size int `yaml:"size"`
+	// FullPayload additionally keeps the raw packet bytes (hex in the
+	// API); off by default to bound memory.
+	FullPayload bool `yaml:"full_payload"`
+}
+
+// historyEntry is one remembered packet.
+type historyEntry struct {
+	Time    time.Time `json:"time"`
+	SrcIP   string    `json:"src_ip"`
+	Class   string    `json:"class"`
+	Summary string    `json:"summary"`
+	Payload string    `json:"payload,omitempty"`
+}
+
+// historyRing keeps the rings, one per interface.
+type historyRing struct {
+	cfg *HistoryConfig
+	mu  sync.Mutex
+	// rings[iface] is a circular buffer; next[iface] the write position.
+	rings map[string][]historyEntry
+	next  map[string]int
+}
+
+func newHistoryRing(cfg *HistoryConfig) *historyRing {
+	return &historyRing{
+		cfg:   cfg,
+		rings: make(map[string][]historyEntry),
+		next:  make(map[string]int),
+	}
+}
+
+// observe records one decoded packet.
+func (h *historyRing) observe(pkt *packet, iface string) {
+	if h.cfg.Size <= 0 || iface == "" {
+		return
+	}
+	e := historyEntry{
+		Time:    time.Now(),
+		SrcIP:   pkt.src.IP.String(),
+		Class:   pkt.class(),
+		Summary: getMsgSummary(pkt.msg),
+	}
+	if h.cfg.FullPayload {
+		e.Payload = hex.EncodeToString(pkt.payload)
+	}
+	h.mu.Lock()
+	ring, ok := h.rings[iface]
+	if !ok {
+		ring = make([]historyEntry, 0, h.cfg.Size)
+	}
+	if len(ring) < h.cfg.Size {
+		ring = append(ring, e)
+	} else {
+		ring[h.next[iface]] = e
+	}
+	h.next[iface] = (h.next[iface] + 1) % h.cfg.Size
+	h.rings[iface] = ring
+	h.mu.Unlock()
+}
+
+// snapshot returns an interface's ring oldest-first.
+func (h *historyRing) snapshot(iface string) []historyEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ring := h.rings[iface]
+	out := make([]historyEntry, 0, len(ring))
+	if len(ring) == h.cfg.Size {
+		out = append(out, ring[h.next[iface]:]...)
+		out = append(out, ring[:h.next[iface]]...)
+	} else {
+		out = append(out, ring...)
+	}
+	return out
+}
+
+// ifaces lists interfaces with recorded history.
+func (h *historyRing) ifaces() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]string, 0, len(h.rings))
+	for name := range h.rings {
+		out = append(out, name)
+	}
+	return out
+}
+
+// historyHandler serves the ring:
+// GET /history?iface=vlan.30 — entries for one interface,
+// GET /history — the interfaces that have any.
+func (a *apiServer) historyHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if iface := req.URL.Query().Get("iface"); iface != "" {
+		entries := a.r.history.snapshot(iface)
+		if mode := a.r.config().Privacy.History; mode != "" {
+			for i := range entries {
+				entries[i].SrcIP = scrubIP(entries[i].SrcIP, mode)
+				entries[i].Summary = scrubText(entries[i].Summary, mode)
+				// Raw payloads contain every name verbatim.
+				entries[i].Payload = ""
+			}
+		}
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+	json.NewEncoder(w).Encode(a.r.history.ifaces())
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// hostTable tracks the current IPs of .local hostnames as learned from A
+// records passing through the reflector. Filters with hostname-based
+// allowed_ips entries resolve against it, so a device that renews its DHCP
+// lease keeps matching without a config change.
+type hostTable struct {
+	mu     sync.Mutex
+	byName map[string][]string // normalized hostname -> current IPs
+}
+
+var localHosts = &hostTable{byName: make(map[string][]string)}
+
+// normalizeHostname lowercases and fully qualifies a hostname so config
+// entries ("printer", "printer.local") and wire names ("Printer.local.")
+// compare equal.
+func normalizeHostname(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if !strings.HasSuffix(name, ".local") {
+		name += ".local"
+	}
+	return name
+}
+
+// hostTableCap bounds the learned table like the other learned state;
+// when untrusted records fill it, it is reset and relearned from live
+// traffic.
+const hostTableCap = 4096
+
+// update records the full address set from one announcement. A host
+// re-announcing replaces its previous addresses, so an IP released back
+// to the DHCP pool stops matching; multiple addresses in one
+// announcement are all kept.
+func (t *hostTable) update(name string, ips []string) {
+	key := normalizeHostname(name)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.byName[key]; !ok && len(t.byName) >= hostTableCap {
+		t.byName = make(map[string][]string)
+	}
+	t.byName[key] = ips
+}
+
+// contains reports whether ip is a current address of the named host.
+func (t *hostTable) contains(name, ip string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, have := range t.byName[normalizeHostname(name)] {
+		if have == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// flush clears all learned addresses.
+func (t *hostTable) flush() {
+	t.mu.Lock()
+	t.byName = make(map[string][]string)
+	t.mu.Unlock()
+}
+
+// observeHosts feeds the A records of a response into the host table,
+// one replacement per announced name.
+func (t *hostTable) observeHosts(pkt *packet) {
+	if !pkt.msg.Response {
+		return
+	}
+	byName := make(map[string][]string)
+	for _, rr := range append(append([]dns.RR{}, pkt.msg.Answer...), pkt.msg.Extra...) {
+		if a, ok := rr.(*dns.A); ok {
+			byName[a.Hdr.Name] = append(byName[a.Hdr.Name], a.A.String())
+		}
+	}
+	for name, ips := range byName {
+		t.update(name, ips)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log"
+	"net"
+)
+
+// Interface hotplug. VLAN sub-interfaces and USB NICs routinely appear
+// after boot, and without a watcher a configured-but-absent interface
+// stayed dead until a restart. With hotplug enabled, a missing interface
+// is tolerated at startup and the kernel's link notifications (netlink
+// on Linux) drive joining and leaving the multicast group as interfaces
+// come, go and flap.
+
+// linkEvent is one kernel link notification.
+type linkEvent struct {
+	name string
+	// up is the link's administrative state; gone means the link was
+	// deleted outright.
+	up   bool
+	gone bool
+}
+
+// startHotplug subscribes to link events when hotplug is enabled.
+func startHotplug(cfg *Config, r *Reflector) {
+	if !cfg.Hotplug {
+		return
+	}
+	if err := sys.WatchLinks(r.linkEvent); err != nil {
+		log.Printf("hotplug: %v", err)
+	}
+}
+
+// configuredGroup returns the group listing an interface name in the
+// static config, attached or not.
+func (r *Reflector) configuredGroup(name string) *Group {
+	cfg := r.config()
+	for gi := range cfg.Groups {
+		for _, n := range cfg.Groups[gi].Interfaces {
+			if n == name {
+				return &cfg.Groups[gi]
+			}
+		}
+	}
+	return nil
+}
+
+// linkEvent reacts to one kernel link notification for a configured
+// interface: joining on appearance, dropping state on removal.
+func (r *Reflector) linkEvent(ev linkEvent) {
+	g := r.configuredGroup(ev.name)
+	if g == nil {
+		return
+	}
+	if ev.gone || !ev.up {
+		r.linkDown(ev.name)
+		return
+	}
+	r.linkUp(ev.name, g)
+}
+
+// linkUp (re)joins the multicast group on an interface that appeared or
+// came back up.
+func (r *Reflector) linkUp(name string, g *Group) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		log.Printf("hotplug: interface %s announced but not resolvable: %v", name, err)
+		return
+	}
+	r.mu.Lock()
+	if old, ok := r.ifaces[name]; ok && old.Index == ifi.Index {
+		// A flap of a known link: refresh the cached state and rejoin
+		// below in case the kernel dropped the membership.
+		r.ifaces[name] = ifi
+		r.mu.Unlock()
+	} else {
+		if old, ok := r.ifaces[name]; ok {
+			delete(r.ifaceIndex, old.Index)
+		}
+		r.ifaces[name] = ifi
+		r.ifaceIndex[ifi.Index] = g
+		r.buildBridgeMap()
+		r.mu.Unlock()
+	}
+	if err := r.connFor(name).JoinGroup(ifi, mdnsGroup); err != nil {
+		// EADDRINUSE here means the membership survived the flap.
+		log.Printf("hotplug: joining %s on %s: %v", mdnsGroup.IP, name, err)
+		return
+	}
+	metrics.Inc("mdns_hotplug_events_total", Labels{"event": "join"})
+	log.Printf("hotplug: joined %s on %s (group %q)", mdnsGroup.IP, name, g.Name)
+}
+
+// linkDown forgets a departed interface. Its group membership in the
+// config is kept so a reappearance rejoins it.
+func (r *Reflector) linkDown(name string) {
+	r.mu.Lock()
+	ifi, ok := r.ifaces[name]
+	if ok {
+		delete(r.ifaces, name)
+		delete(r.ifaceIndex, ifi.Index)
+		r.buildBridgeMap()
+	}
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+	metrics.Inc("mdns_hotplug_events_total", Labels{"event": "leave"})
+	log.Printf("hotplug: interface %s went away", name)
+}
@@ -0,0 +1,76 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// WatchLinks subscribes to rtnetlink link notifications and delivers one
+// linkEvent per RTM_NEWLINK/RTM_DELLINK message carrying an interface
+// name.
+func (nativeSockOps) WatchLinks(cb func(linkEvent)) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return fmt.Errorf("netlink socket: %w", err)
+	}
+	sa := &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: unix.RTMGRP_LINK}
+	if err := unix.Bind(fd, sa); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("netlink bind: %w", err)
+	}
+	go func() {
+		defer unix.Close(fd)
+		buf := make([]byte, 8192)
+		for {
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if err == unix.EINTR {
+					continue
+				}
+				log.Printf("hotplug: netlink read: %v", err)
+				return
+			}
+			msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+			for i := range msgs {
+				m := &msgs[i]
+				if m.Header.Type != unix.RTM_NEWLINK && m.Header.Type != unix.RTM_DELLINK {
+					continue
+				}
+				if len(m.Data) < unix.SizeofIfInfomsg {
+					continue
+				}
+				ifim := (*unix.IfInfomsg)(unsafe.Pointer(&m.Data[0]))
+				attrs, err := syscall.ParseNetlinkRouteAttr(m)
+				if err != nil {
+					continue
+				}
+				var name string
+				for _, a := range attrs {
+					if a.Attr.Type == unix.IFLA_IFNAME {
+						name = string(bytes.TrimRight(a.Value, "\x00"))
+						break
+					}
+				}
+				if name == "" {
+					continue
+				}
+				cb(linkEvent{
+					name: name,
+					up:   ifim.Flags&unix.IFF_UP != 0,
+					gone: m.Header.Type == unix.RTM_DELLINK,
+				})
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// WatchLinks needs rtnetlink; hotplug is a Linux feature.
+func (nativeSockOps) WatchLinks(cb func(linkEvent)) error {
+	return fmt.Errorf("interface hotplug is only supported on linux")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// sendErrorThreshold is how many consecutive send failures on an interface
+// mark it degraded and start recovery.
+const sendErrorThreshold = 5
+
+// recoveryInterval is how often a degraded interface is re-probed.
+const recoveryInterval = 10 * time.Second
+
+// ifaceState tracks send health for one destination interface so repeated
+// WriteTo failures (interface down, ENETUNREACH) surface as a degraded
+// state with automatic rejoin attempts instead of an endless log stream.
+type ifaceState struct {
+	mu          sync.Mutex
+	consecutive int
+	degraded    bool
+	recovering  bool
+}
+
+func (r *Reflector) state(name string) *ifaceState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st, ok := r.ifaceStates[name]
+	if !ok {
+		st = &ifaceState{}
+		r.ifaceStates[name] = st
+	}
+	return st
+}
+
+// noteSendOK resets the failure streak after a successful write.
+func (r *Reflector) noteSendOK(name string) {
+	r.fanout.observeOut()
+	st := r.state(name)
+	st.mu.Lock()
+	st.consecutive = 0
+	if st.degraded {
+		st.degraded = false
+		metrics.Set("mdns_iface_degraded", Labels{"iface": name}, 0)
+		log.Printf("interface %s recovered", name)
+	}
+	st.mu.Unlock()
+}
+
+// noteSendError counts a failed write and kicks off recovery once the
+// failure streak crosses the threshold.
+func (r *Reflector) noteSendError(name string, err error) {
+	metrics.Inc("mdns_send_errors_total", Labels{"iface": name})
+	st := r.state(name)
+	st.mu.Lock()
+	st.consecutive++
+	trigger := st.consecutive >= sendErrorThreshold && !st.degraded
+	if trigger {
+		st.degraded = true
+		if !st.recovering {
+			st.recovering = true
+			go r.recoverIface(name, st)
+		}
+	}
+	st.mu.Unlock()
+	if trigger {
+		metrics.Set("mdns_iface_degraded", Labels{"iface": name}, 1)
+		log.Printf("interface %s marked degraded after %d consecutive send errors (last: %v)", name, sendErrorThreshold, err)
+	}
+}
+
+// recoverIface periodically re-resolves the interface and rejoins the
+// multicast group until sends succeed again. The interface index can change
+// when a link is recreated (VLAN teardown, USB NIC replug), so the cached
+// net.Interface is refreshed too.
+func (r *Reflector) recoverIface(name string, st *ifaceState) {
+	for {
+		time.Sleep(recoveryInterval)
+		st.mu.Lock()
+		done := !st.degraded
+		if done {
+			st.recovering = false
+		}
+		st.mu.Unlock()
+		if done {
+			return
+		}
+		ifi, err := net.InterfaceByName(name)
+		if err != nil {
+			log.Printf("recovery: interface %s still unavailable: %v", name, err)
+			continue
+		}
+		r.mu.Lock()
+		old := r.ifaces[name]
+		r.ifaces[name] = ifi
+		if old != nil && old.Index != ifi.Index {
+			if g, ok := r.ifaceIndex[old.Index]; ok {
+				delete(r.ifaceIndex, old.Index)
+				r.ifaceIndex[ifi.Index] = g
+			}
+		}
+		r.mu.Unlock()
+		conn := r.connFor(name)
+		conn.LeaveGroup(ifi, mdnsGroup) // best effort; may not be joined
+		if err := conn.JoinGroup(ifi, mdnsGroup); err != nil {
+			log.Printf("recovery: rejoining %s on %s: %v", mdnsGroup.IP, name, err)
+			continue
+		}
+		log.Printf("recovery: rejoined multicast group on %s", name)
+		st.mu.Lock()
+		st.consecutive = 0
+		st.degraded = false
+		st.recovering = false
+		st.mu.Unlock()
+		metrics.Set("mdns_iface_degraded", Labels{"iface": name}, 0)
+		return
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// inventoryEntry is one discovered service instance with the facts
+// accumulated from PTR/SRV/TXT/A records seen in responses.
+type inventoryEntry struct {
+	Instance string   `json:"instance"`
+	Service  string   `json:"service"`
+	Host     string   `json:"host,omitempty"`
+	Label    string   `json:"label,omitempty"`
+	Port     uint16   `json:"port,omitempty"`
+	IPs      []string `json:"ips,omitempty"`
+	Text     []string `json:"txt,omitempty"`
+	Iface    string   `json:"iface"`
+	SrcIP    string   `json:"src_ip"`
+	// AP and Network come from the UniFi directory when configured.
+	AP      string `json:"ap,omitempty"`
+	Network string `json:"network,omitempty"`
+	// Unreachable is set by the connectivity verifier when the
+	// advertised endpoint refuses connections; see verify.go.
+	Unreachable bool      `json:"unreachable,omitempty"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	// Expires is when the advertised TTL runs out; an entry past its
+	// expiry is dropped from snapshots, matching what a cache-respecting
+	// client would still believe exists.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// inventory is the passive registry of everything the reflector has seen
+// announce itself, keyed by service instance name.
+type inventory struct {
+	mu      sync.Mutex
+	entries map[string]*inventoryEntry
+	// maxEntries bounds the table in low-memory mode; 0 means unbounded.
+	maxEntries int
+	// events, when set, receives device-new and device-gone as
+	// instances appear and disappear; see notify.go.
+	events *eventBus
+}
+
+// publishChange emits a device lifecycle event; the caller holds inv.mu.
+func (inv *inventory) publishChange(evType string, e *inventoryEntry, why string) {
+	if inv.events == nil {
+		return
+	}
+	inv.events.publish(Event{
+		Type:    evType,
+		Iface:   e.Iface,
+		SrcIP:   e.SrcIP,
+		Device:  e.Instance,
+		Summary: e.Instance + " " + why + " " + e.Iface,
+	})
+}
+
+func newInventory() *inventory {
+	return &inventory{entries: make(map[string]*inventoryEntry)}
+}
+
+// observe folds one response into the inventory.
+func (inv *inventory) observe(pkt *packet, iface string) {
+	if !pkt.msg.Response {
+		return
+	}
+	now := time.Now()
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	records := append(append([]dns.RR{}, pkt.msg.Answer...), pkt.msg.Extra...)
+	hostIPs := make(map[string][]string)
+	for _, rr := range records {
+		if a, ok := rr.(*dns.A); ok {
+			hostIPs[a.Hdr.Name] = append(hostIPs[a.Hdr.Name], a.A.String())
+		}
+	}
+	for _, rr := range records {
+		switch rec := rr.(type) {
+		case *dns.PTR:
+			if serviceOfName(rec.Hdr.Name) == "" {
+				continue
+			}
+			if rec.Hdr.Ttl == 0 {
+				if e, ok := inv.entries[rec.Ptr]; ok {
+					inv.publishChange("device-gone", e, "said goodbye on")
+					delete(inv.entries, rec.Ptr)
+				}
+				continue
+			}
+			e := inv.entry(rec.Ptr, iface, pkt.src.IP.String(), now)
+			e.Service = serviceOfName(rec.Hdr.Name)
+			e.extendExpiry(now, rec.Hdr.Ttl)
+		case *dns.SRV:
+			if serviceOfName(rec.Hdr.Name) == "" {
+				continue
+			}
+			if rec.Hdr.Ttl == 0 {
+				if e, ok := inv.entries[rec.Hdr.Name]; ok {
+					inv.publishChange("device-gone", e, "said goodbye on")
+					delete(inv.entries, rec.Hdr.Name)
+				}
+				continue
+			}
+			e := inv.entry(rec.Hdr.Name, iface, pkt.src.IP.String(), now)
+			e.Host = rec.Target
+			e.Port = rec.Port
+			if e.Service == "" {
+				e.Service = serviceOfName(rec.Hdr.Name)
+			}
+			e.extendExpiry(now, rec.Hdr.Ttl)
+			for _, ip := range hostIPs[rec.Target] {
+				e.addIP(ip)
+			}
+		case *dns.TXT:
+			if serviceOfName(rec.Hdr.Name) == "" || rec.Hdr.Ttl == 0 {
+				continue
+			}
+			e := inv.entry(rec.Hdr.Name, iface, pkt.src.IP.String(), now)
+			if e.Service == "" {
+				e.Service = serviceOfName(rec.Hdr.Name)
+			}
+			e.Text = append([]string{}, rec.Txt...)
+		}
+	}
+}
+
+// extendExpiry pushes an entry's expiry out to now+ttl, never pulling an
+// already later expiry back in.
+func (e *inventoryEntry) extendExpiry(now time.Time, ttl uint32) {
+	exp := now.Add(time.Duration(ttl) * time.Second)
+	if exp.After(e.Expires) {
+		e.Expires = exp
+	}
+}
+
+// expireLocked drops entries whose advertised TTL has run out; the
+// caller holds inv.mu. Entries seen before expiry tracking existed
+// (restored from an old state file) have no expiry and are kept.
+func (inv *inventory) expireLocked(now time.Time) {
+	for k, e := range inv.entries {
+		if !e.Expires.IsZero() && now.After(e.Expires) {
+			inv.publishChange("device-gone", e, "expired on")
+			delete(inv.entries, k)
+		}
+	}
+}
+
+// entry finds or creates the instance entry; the caller holds inv.mu.
+func (inv *inventory) entry(instance, iface, srcIP string, now time.Time) *inventoryEntry {
+	e, ok := inv.entries[instance]
+	if !ok {
+		if inv.maxEntries > 0 && len(inv.entries) >= inv.maxEntries {
+			inv.evictOldest()
+		}
+		e = &inventoryEntry{Instance: instance, FirstSeen: now, Iface: iface, SrcIP: srcIP}
+		inv.entries[instance] = e
+		inv.publishChange("device-new", e, "appeared on")
+	}
+	e.Iface = iface
+	e.SrcIP = srcIP
+	e.LastSeen = now
+	return e
+}
+
+func (e *inventoryEntry) addIP(ip string) {
+	for _, have := range e.IPs {
+		if have == ip {
+			return
+		}
+	}
+	e.IPs = append(e.IPs, ip)
+}
+
+// evictOldest drops the least recently seen entry; the caller holds inv.mu.
+func (inv *inventory) evictOldest() {
+	var oldest string
+	var when time.Time
+	for k, e := range inv.entries {
+		if oldest == "" || e.LastSeen.Before(when) {
+			oldest = k
+			when = e.LastSeen
+		}
+	}
+	if oldest != "" {
+		delete(inv.entries, oldest)
+	}
+}
+
+// setUnreachable updates an instance's reachability flag, reporting
+// whether it changed.
+func (inv *inventory) setUnreachable(instance string, unreachable bool) bool {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	e, ok := inv.entries[instance]
+	if !ok || e.Unreachable == unreachable {
+		return false
+	}
+	e.Unreachable = unreachable
+	return true
+}
+
+// flush clears all learned entries.
+func (inv *inventory) flush() {
+	inv.mu.Lock()
+	inv.entries = make(map[string]*inventoryEntry)
+	inv.mu.Unlock()
+}
+
+// snapshot returns the entries sorted by instance name.
+// restore merges entries from an imported state file; live observations
+// win over restored ones.
+func (inv *inventory) restore(entries []inventoryEntry) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	for i := range entries {
+		e := entries[i]
+		if _, ok := inv.entries[e.Instance]; ok {
+			continue
+		}
+		if inv.maxEntries > 0 && len(inv.entries) >= inv.maxEntries {
+			return
+		}
+		inv.entries[e.Instance] = &e
+	}
+}
+
+func (inv *inventory) snapshot() []inventoryEntry {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.expireLocked(time.Now())
+	out := make([]inventoryEntry, 0, len(inv.entries))
+	for _, e := range inv.entries {
+		copied := *e
+		mac := lookupMAC(net.ParseIP(copied.SrcIP))
+		copied.Label = deviceNames.lookup(copied.Instance, mac)
+		if uc := unifiDir.lookup(mac); uc != (unifiClient{}) {
+			if copied.Label == "" {
+				copied.Label = uc.Label
+			}
+			copied.AP = uc.AP
+			copied.Network = uc.Network
+		}
+		out = append(out, copied)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Instance < out[j].Instance })
+	return out
+}
+
+// inventoryHandler lists the discovered service instances:
+// GET /inventory, optionally filtered by ?iface= and ?service=.
+func (a *apiServer) inventoryHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	wantIface := req.URL.Query().Get("iface")
+	wantService := normalizeService(req.URL.Query().Get("service"))
+	entries := a.r.inv.snapshot()
+	out := entries[:0]
+	for _, e := range entries {
+		if wantIface != "" && e.Iface != wantIface {
+			continue
+		}
+		if wantService != "" && e.Service != wantService {
+			continue
+		}
+		out = append(out, e)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// listInventory implements the `-list` command: it fetches /inventory
+// from the running daemon named by the config and prints a table.
+func listInventory(cfg *Config) error {
+	if cfg.API.Listen == "" {
+		return fmt.Errorf("api.listen is not configured")
+	}
+	addr := cfg.API.Listen
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	scheme := "http"
+	client := http.DefaultClient
+	if cfg.API.TLS.CertFile != "" {
+		scheme = "https"
+		// The daemon's cert rarely names the loopback address we dial.
+		client = &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}}
+	}
+	resp, err := client.Get(scheme + "://" + addr + "/inventory")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("daemon returned %s", resp.Status)
+	}
+	var entries []inventoryEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "INSTANCE\tSERVICE\tIFACE\tADDRESS\tLABEL\tLAST SEEN")
+	for _, e := range entries {
+		addr := e.SrcIP
+		if len(e.IPs) > 0 {
+			addr = e.IPs[0]
+		}
+		if e.Port != 0 {
+			addr = fmt.Sprintf("%s:%d", addr, e.Port)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Instance, e.Service, e.Iface, addr, e.Label,
+			e.LastSeen.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// Native journald integration. When running under systemd, decision events
+// are written to the journal over its native datagram protocol with
+// structured fields, so `journalctl -u mdns-reflector RULE="rule 2"` or
+// IFACE=vlan.30 filters work without grep.
+
+// journalSocket is systemd-journald's native protocol endpoint.
+const journalSocket = "/run/systemd/journal/socket"
+
+// JournalConfig enables native journal output for events.
+type JournalConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type journalWriter struct {
+	conn *net.UnixConn
+}
+
+// startJournal subscribes to the event bus and writes each event as a
+// structured journal entry.
+func startJournal(cfg *Config, r *Reflector) {
+	if !cfg.Journal.Enabled {
+		return
+	}
+	if _, err := os.Stat(journalSocket); err != nil {
+		log.Printf("journal output requested but %s is unavailable: %v", journalSocket, err)
+		return
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		log.Printf("journal output: %v", err)
+		return
+	}
+	j := &journalWriter{conn: conn}
+	ch, _ := r.events.subscribe()
+	go func() {
+		for ev := range ch {
+			j.write(ev)
+		}
+	}()
+	log.Printf("writing events to the systemd journal")
+}
+
+// write renders one event in the native protocol: KEY=value lines, with
+// the length-framed binary form for values containing newlines.
+func (j *journalWriter) write(ev Event) {
+	var buf bytes.Buffer
+	appendField(&buf, "MESSAGE", ev.Summary)
+	appendField(&buf, "PRIORITY", "6")
+	appendField(&buf, "EVENT_TYPE", ev.Type)
+	appendField(&buf, "IFACE", ev.Iface)
+	appendField(&buf, "RULE", ev.Rule)
+	appendField(&buf, "SRC_IP", ev.SrcIP)
+	appendField(&buf, "ACTION", ev.Action)
+	appendField(&buf, "DEVICE", ev.Device)
+	if len(ev.Dsts) > 0 {
+		appendField(&buf, "DESTINATIONS", strings.Join(ev.Dsts, " "))
+	}
+	j.conn.Write(buf.Bytes())
+}
+
+func appendField(buf *bytes.Buffer, key, value string) {
+	if value == "" {
+		return
+	}
+	if strings.ContainsAny(value, "\n") {
+		buf.WriteString(key)
+		buf.WriteByte('\n')
+		binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
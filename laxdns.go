@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Tolerant decode fallback. Some devices emit messages the strict
+// unpacker rejects — a malformed TXT record, a stray trailing byte — yet
+// the question section at the front of the packet is perfectly readable.
+// With lax_decode enabled, such a packet is re-read by a minimal manual
+// parser that recovers the header bits and whatever questions it can, so
+// the packet still flows through filtering, logging and reflection; the
+// original bytes are forwarded untouched.
+
+// laxMaxQuestions bounds how many questions the fallback parser reads; a
+// claimed count beyond this is itself evidence of garbage.
+const laxMaxQuestions = 64
+
+// parseLax recovers a packet from a payload the strict unpacker refused.
+// Only the header flags and the question section are decoded; a payload
+// whose questions cannot be read at all returns false.
+func parseLax(payload []byte) (*dns.Msg, bool) {
+	if len(payload) < 12 {
+		return nil, false
+	}
+	flags := binary.BigEndian.Uint16(payload[2:4])
+	qdcount := int(binary.BigEndian.Uint16(payload[4:6]))
+	if qdcount > laxMaxQuestions {
+		return nil, false
+	}
+	msg := new(dns.Msg)
+	msg.Id = binary.BigEndian.Uint16(payload[0:2])
+	msg.Response = flags&0x8000 != 0
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		name, next, ok := laxName(payload, off)
+		if !ok || next+4 > len(payload) {
+			break
+		}
+		msg.Question = append(msg.Question, dns.Question{
+			Name:   name,
+			Qtype:  binary.BigEndian.Uint16(payload[next : next+2]),
+			Qclass: binary.BigEndian.Uint16(payload[next+2 : next+4]),
+		})
+		off = next + 4
+	}
+	if !msg.Response && len(msg.Question) == 0 {
+		return nil, false
+	}
+	return msg, true
+}
+
+// laxName reads one possibly-compressed domain name starting at off,
+// returning the dotted name and the offset just past it in the original
+// stream. Pointer loops and out-of-range offsets fail the read.
+func laxName(payload []byte, off int) (string, int, bool) {
+	var b strings.Builder
+	next := -1
+	hops := 0
+	for {
+		if off >= len(payload) {
+			return "", 0, false
+		}
+		c := int(payload[off])
+		switch {
+		case c == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			if b.Len() == 0 {
+				return ".", next, true
+			}
+			return b.String(), next, true
+		case c&0xc0 == 0xc0:
+			if off+1 >= len(payload) {
+				return "", 0, false
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = (c&0x3f)<<8 | int(payload[off+1])
+			hops++
+			if hops > 16 {
+				return "", 0, false
+			}
+		case c&0xc0 != 0:
+			return "", 0, false
+		default:
+			if off+1+c > len(payload) {
+				return "", 0, false
+			}
+			b.Write(payload[off+1 : off+1+c])
+			b.WriteByte('.')
+			off += 1 + c
+		}
+	}
+}
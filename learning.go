@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Learning mode. A fresh install faces a chicken-and-egg problem: the
+// rules worth writing are the ones describing traffic nobody has seen
+// yet. With a learning period configured, the reflector starts out
+// permissive — every packet crosses every boundary, rules ignored —
+// while recording which service types actually traveled between which
+// groups. When the period ends, reflection snaps back to the configured
+// rules and /learning serves a locked-down rule set built from the
+// evidence, ready to paste into the config.
+
+// LearningConfig enables the permissive learning period.
+type LearningConfig struct {
+	// DurationMinutes is how long reflection stays permissive after
+	// startup; 0 disables learning mode.
+	DurationMinutes int `yaml:"duration_minutes"`
+}
+
+// validate rejects a negative period.
+func (c *LearningConfig) validate() error {
+	if c.DurationMinutes < 0 {
+		return fmt.Errorf("learning: duration_minutes must not be negative")
+	}
+	return nil
+}
+
+// boundary is one directed group-to-group edge.
+type boundary struct {
+	from, to string
+}
+
+// learningState records service usage per boundary during the period.
+type learningState struct {
+	r     *Reflector
+	start time.Time
+	mu    sync.Mutex
+	done  bool
+	// seen[boundary][service] counts queries that crossed the edge.
+	seen map[boundary]map[string]int
+}
+
+func newLearningState(r *Reflector) *learningState {
+	return &learningState{r: r, start: time.Now(), seen: make(map[boundary]map[string]int)}
+}
+
+// active reports whether the permissive period is still running,
+// announcing the transition back to configured rules exactly once.
+func (l *learningState) active() bool {
+	d := l.r.config().Learning.DurationMinutes
+	if d <= 0 {
+		return false
+	}
+	if time.Since(l.start) < time.Duration(d)*time.Minute {
+		return true
+	}
+	l.mu.Lock()
+	announce := !l.done
+	l.done = true
+	l.mu.Unlock()
+	if announce {
+		log.Printf("learning: period over, enforcing configured rules; suggested config at /learning")
+		l.r.events.publish(Event{
+			Type:    "learning-complete",
+			Summary: fmt.Sprintf("learning period ended after %dm; suggested rules available at /learning", d),
+		})
+	}
+	return false
+}
+
+// observe records one permissively reflected query.
+func (l *learningState) observe(fromGroup string, dstGroups []string, pkt *packet) {
+	services := pkt.services()
+	if len(services) == 0 || pkt.msg.Response {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, to := range dstGroups {
+		b := boundary{from: fromGroup, to: to}
+		m, ok := l.seen[b]
+		if !ok {
+			m = make(map[string]int)
+			l.seen[b] = m
+		}
+		for _, svc := range services {
+			m[svc]++
+		}
+	}
+}
+
+// learnedRule is one suggested locked-down rule, shaped to paste into
+// the rules section of the config.
+type learnedRule struct {
+	From   string   `yaml:"from" json:"from"`
+	To     []string `yaml:"to" json:"to"`
+	Filter struct {
+		AllowedServices []string `yaml:"allowed_services" json:"allowed_services"`
+	} `yaml:"filter" json:"filter"`
+}
+
+// suggestedRules folds the observed boundaries into one rule per source
+// group, merging destinations that saw the same traffic.
+func (l *learningState) suggestedRules() []learnedRule {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// byFrom[from][to][service] aggregates the edges per source group.
+	byFrom := make(map[string]map[string]map[string]bool)
+	for b, services := range l.seen {
+		if byFrom[b.from] == nil {
+			byFrom[b.from] = make(map[string]map[string]bool)
+		}
+		if byFrom[b.from][b.to] == nil {
+			byFrom[b.from][b.to] = make(map[string]bool)
+		}
+		for svc := range services {
+			byFrom[b.from][b.to][svc] = true
+		}
+	}
+	var out []learnedRule
+	for from, tos := range byFrom {
+		rule := learnedRule{From: from}
+		union := make(map[string]bool)
+		for to, services := range tos {
+			rule.To = append(rule.To, to)
+			for svc := range services {
+				union[svc] = true
+			}
+		}
+		for svc := range union {
+			rule.Filter.AllowedServices = append(rule.Filter.AllowedServices, svc)
+		}
+		sort.Strings(rule.To)
+		sort.Strings(rule.Filter.AllowedServices)
+		out = append(out, rule)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].From < out[j].From })
+	return out
+}
+
+// learningDestinations lists every interface outside the source group
+// and the group names they belong to, reusing the rule fan-out so
+// excluded interfaces stay excluded.
+func (r *Reflector) learningDestinations(group *Group, srcIface string) (dsts, toGroups []string) {
+	cfg := r.config()
+	for gi := range cfg.Groups {
+		if g := &cfg.Groups[gi]; g.Name != group.Name {
+			toGroups = append(toGroups, g.Name)
+		}
+	}
+	if len(toGroups) == 0 {
+		return nil, nil
+	}
+	return r.ruleDestinations(&Rule{To: toGroups}, srcIface), toGroups
+}
+
+// learningHandler reports the learning state and the suggested rules:
+// GET /learning
+func (a *apiServer) learningHandler(w http.ResponseWriter, req *http.Request) {
+	d := a.r.config().Learning.DurationMinutes
+	rules := a.r.learning.suggestedRules()
+	snippet, err := yaml.Marshal(map[string]any{"rules": rules})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Active          bool          `json:"active"`
+		Started         time.Time     `json:"started"`
+		Ends            time.Time     `json:"ends,omitempty"`
+		SuggestedRules  []learnedRule `json:"suggested_rules"`
+		SuggestedConfig string        `json:"suggested_config"`
+	}{
+		Active:          a.r.learning.active(),
+		Started:         a.r.learning.start,
+		Ends:            a.r.learning.start.Add(time.Duration(d) * time.Minute),
+		SuggestedRules:  rules,
+		SuggestedConfig: string(snippet),
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+
+	"golang.org/x/net/ipv4"
+)
+
+// Legacy unicast queries (RFC 6762 §6.7). A resolver querying from a
+// source port other than 5353 is a one-shot legacy client: it expects a
+// conventional unicast DNS reply to that port and never listens on the
+// multicast group. Blindly reflecting such a query multicasts the
+// answers where the client will not hear them. With legacy_unicast
+// enabled, the reflector answers the client directly — from cache when
+// possible, otherwise by relaying the eventual multicast response back
+// as a unicast reply — with the query ID echoed, cache-flush bits
+// cleared and TTLs capped at ten seconds, as the RFC prescribes for
+// legacy responses.
+
+// legacyTTLCap is the maximum TTL in a legacy unicast reply.
+const legacyTTLCap = 10
+
+// legacyQuerier reports whether a stored querier address identifies a
+// legacy client needing a unicast reply.
+func (r *Reflector) legacyQuerier(q *net.UDPAddr) bool {
+	return r.config().LegacyUnicast && q != nil && q.Port != 0 && q.Port != mdnsGroup.Port
+}
+
+// legacyWire renders a response for a legacy client: the query ID
+// restored, cache-flush bits cleared, TTLs capped.
+func legacyWire(msg *dns.Msg, id uint16) ([]byte, error) {
+	out := msg.Copy()
+	out.Id = id
+	for _, set := range [][]dns.RR{out.Answer, out.Ns, out.Extra} {
+		for _, rr := range set {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypeOPT {
+				continue
+			}
+			hdr.Class &^= classQU
+			if hdr.Ttl > legacyTTLCap {
+				hdr.Ttl = legacyTTLCap
+			}
+		}
+	}
+	return out.Pack()
+}
+
+// sendLegacy unicasts a response to a legacy querier on its interface.
+func (r *Reflector) sendLegacy(msg *dns.Msg, id uint16, ifaceName string, dst *net.UDPAddr, source string) {
+	wire, err := legacyWire(msg, id)
+	if err != nil {
+		r.reportError(errParse, "packing legacy reply", err)
+		return
+	}
+	ifi := r.iface(ifaceName)
+	if ifi == nil {
+		return
+	}
+	if r.config().ObserveOnly {
+		return
+	}
+	cm := &ipv4.ControlMessage{IfIndex: ifi.Index}
+	if _, err := r.connFor(ifaceName).WriteTo(wire, cm, dst); err != nil {
+		r.reportError(errForward, fmt.Sprintf("legacy reply to %s via %s", dst.IP, ifaceName), err)
+		r.noteSendError(ifaceName, err)
+		return
+	}
+	r.noteSendOK(ifaceName)
+	metrics.Inc("mdns_legacy_unicast_total", Labels{"source": source})
+}
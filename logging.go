@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// Structured logging. The daemon's components log through the standard
+// logger; rather than rewriting every call site, the standard logger is
+// routed into a slog handler, which gives every line level filtering
+// (log_level finally does something), optional JSON encoding for log
+// shippers, and a consistent timestamp format. Syslog forwarding set up
+// earlier keeps working: the handler writes to whatever writer the
+// standard logger had.
+
+// parseLogLevel maps the config string to a slog level; unknown strings
+// fall back to info rather than failing startup.
+func parseLogLevel(s string) slog.Level {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug
+	case "", "info":
+		return slog.LevelInfo
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// setupLogging installs the slog backend. Must run after setupSyslog,
+// whose multi-writer it wraps.
+func setupLogging(cfg *Config) {
+	dst := log.Writer()
+	opts := &slog.HandlerOptions{Level: parseLogLevel(cfg.LogLevel)}
+	var h slog.Handler
+	if cfg.LogFormat == "json" {
+		h = slog.NewJSONHandler(dst, opts)
+	} else {
+		h = slog.NewTextHandler(dst, opts)
+	}
+	logger := slog.New(h)
+	slog.SetDefault(logger)
+	// Legacy log.Printf call sites surface as info-level records.
+	log.SetFlags(0)
+	log.SetOutput(slogInfoWriter{logger})
+}
+
+// slogInfoWriter adapts the standard logger's output stream to slog.
+type slogInfoWriter struct{ l *slog.Logger }
+
+func (w slogInfoWriter) Write(p []byte) (int, error) {
+	w.l.Info(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Low-memory mode targets OpenWrt-class devices with 64-128MB of RAM. It
+// shrinks receive buffers to one MTU, caps the passive state tables, sets
+// an aggressive GC and a hard runtime memory limit, and periodically
+// flushes learned state if the heap still approaches the ceiling.
+
+// defaultMemoryLimitMB is the runtime memory ceiling in low-memory mode
+// when memory_limit_mb is not set.
+const defaultMemoryLimitMB = 48
+
+// lowMemInventoryCap bounds inventory entries in low-memory mode.
+const lowMemInventoryCap = 256
+
+// applyLowMemory configures the runtime limits before the reflector
+// starts. It must run before the first packet is received so the buffer
+// pool never holds full-size buffers.
+func applyLowMemory(cfg *Config, r *Reflector) {
+	if !cfg.LowMemory {
+		return
+	}
+	limitMB := cfg.MemoryLimitMB
+	if limitMB <= 0 {
+		limitMB = defaultMemoryLimitMB
+	}
+	packetBufSize = 1500
+	r.inv.maxEntries = lowMemInventoryCap
+	debug.SetGCPercent(30)
+	debug.SetMemoryLimit(int64(limitMB) << 20)
+	log.Printf("low-memory mode: %dMB ceiling, 1500-byte buffers, inventory capped at %d entries", limitMB, lowMemInventoryCap)
+
+	go func() {
+		for range time.Tick(30 * time.Second) {
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			metrics.Set("mdns_heap_bytes", nil, float64(ms.HeapAlloc))
+			// Within 90% of the ceiling: shed learned state rather than
+			// letting the allocator fight the limit.
+			if ms.HeapAlloc > uint64(limitMB)<<20*9/10 {
+				r.inv.flush()
+				localHosts.flush()
+				runtime.GC()
+				log.Printf("low-memory mode: heap at %dMB, flushed learned state", ms.HeapAlloc>>20)
+			}
+		}
+	}()
+}
@@ -0,0 +1,89 @@
+// mdns-reflector forwards mDNS packets between network segments
+// according to a rule-based policy loaded from a YAML config file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+var version = "dev"
+
+func main() {
+	configPath := flag.String("config", "config.yaml", "path to configuration file")
+	debug := flag.Bool("debug", false, "enable debug logging")
+	showVersion := flag.Bool("version", false, "print version and exit")
+	replayDir := flag.String("replay-corpus", "", "replay a recorded packet corpus and exit")
+	list := flag.Bool("list", false, "list the running daemon's service inventory and exit")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("mdns-reflector %s\n", version)
+		os.Exit(0)
+	}
+	if *replayDir != "" {
+		if err := replayCorpus(*replayDir); err != nil {
+			log.Fatalf("replay: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("loading config: %v", err)
+	}
+	if *debug {
+		cfg.Debug = true
+	}
+	if *list {
+		if err := listInventory(cfg); err != nil {
+			log.Fatalf("list: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	r, err := NewReflector(cfg)
+	if err != nil {
+		log.Fatalf("initializing reflector: %v", err)
+	}
+	r.cfgPath = *configPath
+	metrics.SetRevision(cfg.Revision)
+	r.events.setRevision(cfg.Revision)
+	setupSyslog(cfg)
+	setupLogging(cfg)
+	loadDeviceNames(cfg)
+	applyLowMemory(cfg, r)
+	if err := r.Start(); err != nil {
+		log.Fatalf("starting reflector: %v", err)
+	}
+	startAPI(cfg, r)
+	r.health = startHealthChecks(cfg, r)
+	startExporter(cfg, r.inv)
+	startShipper(cfg, r)
+	startJournal(cfg, r)
+	startAgentX(cfg, r)
+	startSocketStats(r)
+	r.bridge = startUnicastFallback(cfg, r)
+	startSSDP(cfg, r)
+	startPauseSignal(r)
+	startReloadSignal(r)
+	if cfg.StatePath != "" {
+		r.importState(cfg.StatePath)
+	}
+	startFDStore(r)
+	r.peers.run()
+	startHotplug(cfg, r)
+	startExecHooks(cfg, r)
+	startNotifications(cfg, r)
+	startUniFi(cfg)
+	startHomeAssistant(cfg, r)
+	startVerifier(cfg, r)
+	if cfg.Learning.DurationMinutes > 0 {
+		log.Printf("learning: reflecting permissively for %dm; suggested rules at /learning", cfg.Learning.DurationMinutes)
+	}
+	log.Printf("mdns-reflector %s started, %d group(s), %d rule(s)", version, len(cfg.Groups), len(cfg.Rules))
+
+	os.Exit(runUntilSignal(r))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Labels attaches dimensions to a metric sample.
+type Labels map[string]string
+
+// Metrics is a small in-process metric registry exposed in Prometheus text
+// format on /metrics. It intentionally supports only counters and gauges;
+// pulling in a full client library is not worth it for a router daemon.
+type Metrics struct {
+	mu    sync.Mutex
+	typ   map[string]string // metric name -> "counter" | "gauge" | "histogram"
+	vals  map[string]map[string]float64
+	hists map[string]map[string]*histogram
+	// revision is spliced into every sample written while it is set, so
+	// series can be correlated with the config deployment that produced
+	// them. Samples written under an earlier revision keep its label.
+	revision string
+}
+
+var metrics = &Metrics{
+	typ:   make(map[string]string),
+	vals:  make(map[string]map[string]float64),
+	hists: make(map[string]map[string]*histogram),
+}
+
+// latencyBuckets are the histogram boundaries, in seconds, used for all
+// duration observations (10µs .. 1s).
+var latencyBuckets = []float64{1e-5, 1e-4, 1e-3, 1e-2, 1e-1, 1}
+
+// histogram is one cumulative-bucket latency series.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	total  uint64
+}
+
+// SetRevision sets the config-revision label stamped on new samples.
+func (m *Metrics) SetRevision(rev string) {
+	m.mu.Lock()
+	m.revision = rev
+	m.mu.Unlock()
+}
+
+// render flattens a label set, adding the current revision.
+func (m *Metrics) render(labels Labels) string {
+	key := renderLabels(labels)
+	if m.revision != "" {
+		key = mergeLabel(key, "revision", m.revision)
+	}
+	return key
+}
+
+// Inc increments a counter by one.
+func (m *Metrics) Inc(name string, labels Labels) {
+	m.Add(name, labels, 1)
+}
+
+// Add increments a counter by delta.
+func (m *Metrics) Add(name string, labels Labels, delta float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.typ[name] = "counter"
+	m.series(name)[m.render(labels)] += delta
+}
+
+// Set sets a gauge to value.
+func (m *Metrics) Set(name string, labels Labels, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.typ[name] = "gauge"
+	m.series(name)[m.render(labels)] = value
+}
+
+// Get returns the current value of a sample, mainly for tests and the API.
+func (m *Metrics) Get(name string, labels Labels) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.series(name)[m.render(labels)]
+}
+
+// Observe adds one sample to a latency histogram.
+func (m *Metrics) Observe(name string, labels Labels, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.typ[name] = "histogram"
+	series, ok := m.hists[name]
+	if !ok {
+		series = make(map[string]*histogram)
+		m.hists[name] = series
+	}
+	key := m.render(labels)
+	h, ok := series[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		series[key] = h
+	}
+	for i, le := range latencyBuckets {
+		if value <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.total++
+}
+
+// Sum returns the total of a metric across every label set.
+func (m *Metrics) Sum(name string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var total float64
+	for _, v := range m.vals[name] {
+		total += v
+	}
+	return total
+}
+
+// SumBy aggregates a metric over one label, returning label value to
+// total. Label sets without the label fall under "".
+func (m *Metrics) SumBy(name, label string) map[string]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]float64)
+	for rendered, v := range m.vals[name] {
+		out[labelValue(rendered, label)] += v
+	}
+	return out
+}
+
+// labelValue extracts one label's value from a rendered label set.
+func labelValue(rendered, label string) string {
+	marker := label + `="`
+	i := strings.Index(rendered, marker)
+	if i < 0 {
+		return ""
+	}
+	rest := rendered[i+len(marker):]
+	if j := strings.IndexByte(rest, '"'); j >= 0 {
+		return rest[:j]
+	}
+	return ""
+}
+
+func (m *Metrics) series(name string) map[string]float64 {
+	s, ok := m.vals[name]
+	if !ok {
+		s = make(map[string]float64)
+		m.vals[name] = s
+	}
+	return s
+}
+
+func renderLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", k, labels[k])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ServeHTTP writes all samples in Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	names := make([]string, 0, len(m.vals))
+	for name := range m.vals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, m.typ[name])
+		keys := make([]string, 0, len(m.vals[name]))
+		for k := range m.vals[name] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s%s %g\n", name, k, m.vals[name][k])
+		}
+	}
+	hnames := make([]string, 0, len(m.hists))
+	for name := range m.hists {
+		hnames = append(hnames, name)
+	}
+	sort.Strings(hnames)
+	for _, name := range hnames {
+		fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+		keys := make([]string, 0, len(m.hists[name]))
+		for k := range m.hists[name] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			h := m.hists[name][k]
+			for i, le := range latencyBuckets {
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, mergeLabel(k, "le", fmt.Sprintf("%g", le)), h.counts[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, mergeLabel(k, "le", "+Inf"), h.total)
+			fmt.Fprintf(w, "%s_sum%s %g\n", name, k, h.sum)
+			fmt.Fprintf(w, "%s_count%s %d\n", name, k, h.total)
+		}
+	}
+}
+
+// mergeLabel splices an extra label into an already-rendered label set.
+func mergeLabel(rendered, key, value string) string {
+	extra := fmt.Sprintf("%s=%q", key, value)
+	if rendered == "" {
+		return "{" + extra + "}"
+	}
+	return strings.TrimSuffix(rendered, "}") + "," + extra + "}"
+}
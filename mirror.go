@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Mirror targets. An IDS (Zeek, Suricata) watching a span port never sees
+// cross-VLAN discovery traffic, because the reflector is the only thing
+// that crosses the VLANs. A rule can therefore name a mirror, and every
+// packet it matches is also copied there: either appended to a pcap file
+// or encapsulated in TZSP over UDP to a remote collector. The copy is
+// synthesized as a full Ethernet/IPv4/UDP frame (zeroed MACs) so standard
+// capture tooling parses it without custom dissectors.
+
+// MirrorConfig describes one named mirror sink.
+type MirrorConfig struct {
+	Name string `yaml:"name"`
+	// Type is "pcap" or "tzsp".
+	Type string `yaml:"type"`
+	// Path is the pcap output file (type pcap).
+	Path string `yaml:"path"`
+	// Address is the host:port of the TZSP collector (type tzsp).
+	Address string `yaml:"address"`
+}
+
+// validate checks one mirror definition.
+func (c *MirrorConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("mirror without a name")
+	}
+	switch c.Type {
+	case "pcap":
+		if c.Path == "" {
+			return fmt.Errorf("mirror %q: pcap type needs path", c.Name)
+		}
+	case "tzsp":
+		if c.Address == "" {
+			return fmt.Errorf("mirror %q: tzsp type needs address", c.Name)
+		}
+	default:
+		return fmt.Errorf("mirror %q: unknown type %q (use pcap or tzsp)", c.Name, c.Type)
+	}
+	return nil
+}
+
+// mirrorSink is one open mirror output.
+type mirrorSink struct {
+	cfg  *MirrorConfig
+	mu   sync.Mutex
+	file *os.File
+	conn net.Conn
+}
+
+// mirrorSet resolves rule mirror names to open sinks.
+type mirrorSet struct {
+	byName map[string]*mirrorSink
+}
+
+// openMirrors opens every configured mirror; a sink that cannot be opened
+// is logged and skipped rather than failing startup.
+func openMirrors(cfg *Config) *mirrorSet {
+	m := &mirrorSet{byName: make(map[string]*mirrorSink)}
+	for i := range cfg.Mirrors {
+		mc := &cfg.Mirrors[i]
+		sink := &mirrorSink{cfg: mc}
+		switch mc.Type {
+		case "pcap":
+			f, err := openPcap(mc.Path)
+			if err != nil {
+				log.Printf("mirror %q: %v", mc.Name, err)
+				continue
+			}
+			sink.file = f
+		case "tzsp":
+			conn, err := net.Dial("udp", mc.Address)
+			if err != nil {
+				log.Printf("mirror %q: %v", mc.Name, err)
+				continue
+			}
+			sink.conn = conn
+		}
+		m.byName[mc.Name] = sink
+	}
+	return m
+}
+
+// copyTo mirrors one packet to a named sink.
+func (m *mirrorSet) copyTo(name string, pkt *packet) {
+	sink := m.byName[name]
+	if sink == nil {
+		return
+	}
+	frame := synthFrame(pkt)
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	var err error
+	switch sink.cfg.Type {
+	case "pcap":
+		err = writePcapRecord(sink.file, frame)
+	case "tzsp":
+		// TZSP: version 1, type 0 (received), protocol 1 (Ethernet),
+		// then the end-of-tags tag.
+		buf := append([]byte{1, 0, 0, 1, 1}, frame...)
+		_, err = sink.conn.Write(buf)
+	}
+	if err != nil {
+		log.Printf("mirror %q: %v", name, err)
+		return
+	}
+	metrics.Inc("mdns_mirrored_total", Labels{"mirror": name})
+}
+
+// synthFrame wraps the mDNS payload in Ethernet/IPv4/UDP headers. MACs
+// are zeroed (the reflector does not know them reliably); the IP layer
+// carries the real source and the mDNS group destination.
+func synthFrame(pkt *packet) []byte {
+	payload := pkt.payload
+	src := pkt.src.IP.To4()
+	if src == nil {
+		src = net.IPv4zero.To4()
+	}
+	frame := make([]byte, 14+20+8+len(payload))
+	// Ethernet: zero MACs, EtherType IPv4.
+	binary.BigEndian.PutUint16(frame[12:], 0x0800)
+	ip := frame[14:]
+	ip[0] = 0x45 // v4, 20-byte header
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+8+len(payload)))
+	ip[8] = 255 // TTL
+	ip[9] = 17  // UDP
+	copy(ip[12:16], src)
+	copy(ip[16:20], mdnsGroup.IP.To4())
+	binary.BigEndian.PutUint16(ip[10:], ipChecksum(ip[:20]))
+	udp := ip[20:]
+	binary.BigEndian.PutUint16(udp[0:], uint16(pkt.src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(mdnsGroup.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(payload)))
+	// UDP checksum 0: legal for IPv4, and capture tools do not verify.
+	copy(udp[8:], payload)
+	return frame
+}
+
+// ipChecksum is the ones-complement header checksum with the checksum
+// field treated as zero.
+func ipChecksum(hdr []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(hdr); i += 2 {
+		if i == 10 {
+			continue
+		}
+		sum += uint32(binary.BigEndian.Uint16(hdr[i:]))
+	}
+	for sum > 0xffff {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
+
+// openPcap opens (or creates) a pcap file, writing the global header only
+// when the file is new.
+func openPcap(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if st, err := f.Stat(); err == nil && st.Size() == 0 {
+		hdr := make([]byte, 24)
+		binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4) // magic
+		binary.LittleEndian.PutUint16(hdr[4:], 2)          // major
+		binary.LittleEndian.PutUint16(hdr[6:], 4)          // minor
+		binary.LittleEndian.PutUint32(hdr[16:], 65535)     // snaplen
+		binary.LittleEndian.PutUint32(hdr[20:], 1)         // LINKTYPE_ETHERNET
+		if _, err := f.Write(hdr); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// writePcapRecord appends one frame with its record header.
+func writePcapRecord(f *os.File, frame []byte) error {
+	now := time.Now()
+	hdr := make([]byte, 16)
+	binary.LittleEndian.PutUint32(hdr[0:], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(hdr[8:], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(hdr[12:], uint32(len(frame)))
+	if _, err := f.Write(append(hdr, frame...)); err != nil {
+		return err
+	}
+	return nil
+}
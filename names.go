@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// nameRegistry maps a stable device key — a MAC address or a service
+// instance name — to a friendly label like "Kitchen HomePod". Labels
+// survive IP and hostname changes because the key does; assignments are
+// persisted to disk so they also survive restarts.
+type nameRegistry struct {
+	mu    sync.Mutex
+	path  string
+	byKey map[string]string
+}
+
+var deviceNames = &nameRegistry{byKey: make(map[string]string)}
+
+// loadDeviceNames reads the registry from names_path, if configured.
+func loadDeviceNames(cfg *Config) {
+	if cfg.NamesPath == "" {
+		return
+	}
+	deviceNames.path = cfg.NamesPath
+	data, err := os.ReadFile(cfg.NamesPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("device names: %v", err)
+		}
+		return
+	}
+	deviceNames.mu.Lock()
+	defer deviceNames.mu.Unlock()
+	if err := json.Unmarshal(data, &deviceNames.byKey); err != nil {
+		log.Printf("device names: %s: %v", cfg.NamesPath, err)
+		return
+	}
+	log.Printf("device names: loaded %d labels from %s", len(deviceNames.byKey), cfg.NamesPath)
+}
+
+// lookup returns the label for the first key that has one, or "".
+func (n *nameRegistry) lookup(keys ...string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if label, ok := n.byKey[key]; ok {
+			return label
+		}
+	}
+	return ""
+}
+
+// assign sets (or with an empty label, removes) the label for a key and
+// persists the registry.
+func (n *nameRegistry) assign(key, label string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if label == "" {
+		delete(n.byKey, key)
+	} else {
+		n.byKey[key] = label
+	}
+	return n.save()
+}
+
+// save writes the registry atomically (temp file plus rename); the caller
+// holds n.mu. With no path configured assignments stay in memory only.
+func (n *nameRegistry) save() error {
+	if n.path == "" {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(n.path), ".mdns-reflector-names-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	enc := json.NewEncoder(tmp)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(n.byKey); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), n.path)
+}
+
+// snapshot returns a copy of the key-to-label map.
+func (n *nameRegistry) snapshot() map[string]string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	out := make(map[string]string, len(n.byKey))
+	for k, v := range n.byKey {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// lookupMAC resolves an IP to its MAC address via the kernel's ARP table,
+// or "" when the entry is unknown. The source of an mDNS packet has by
+// definition just talked to us, so its neighbor entry is normally fresh.
+func lookupMAC(ip net.IP) string {
+	raw, err := os.ReadFile("/proc/net/arp")
+	if err != nil {
+		return ""
+	}
+	want := ip.String()
+	lines := strings.Split(string(raw), "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != want {
+			continue
+		}
+		if fields[3] == "00:00:00:00:00:00" {
+			return ""
+		}
+		return strings.ToLower(fields[3])
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Webhook notifications. "Tell me when an unknown device shows up on the
+// IoT VLAN" is an alerting question, and the answer lives wherever the
+// user already looks — a chat channel, ntfy, Home Assistant's webhook
+// trigger. The inventory publishes device-new and device-gone events as
+// instances appear and disappear; each configured webhook POSTs selected
+// events to its URL with a templated JSON body, so the payload can match
+// whatever the receiving end expects.
+
+// NotificationsConfig holds the configured webhooks.
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+}
+
+// WebhookConfig is one notification target.
+type WebhookConfig struct {
+	// URL receives a POST per selected event.
+	URL string `yaml:"url"`
+	// Events selects the event types delivered; default device-new and
+	// device-gone.
+	Events []string `yaml:"events"`
+	// Body is a JSON template with ${type}, ${device}, ${iface},
+	// ${src_ip}, ${summary} and ${time} placeholders; empty sends the
+	// event object itself.
+	Body string `yaml:"body"`
+	// TimeoutSeconds bounds one delivery; default 10.
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+}
+
+// validate checks one webhook entry.
+func (c *WebhookConfig) validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("notifications: webhook has no url")
+	}
+	if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+		return fmt.Errorf("notifications: webhook url %q is not http(s)", c.URL)
+	}
+	if len(c.Events) == 0 {
+		c.Events = []string{"device-new", "device-gone"}
+	}
+	if c.TimeoutSeconds <= 0 {
+		c.TimeoutSeconds = 10
+	}
+	return nil
+}
+
+// wants reports whether the webhook fires for an event type.
+func (c *WebhookConfig) wants(evType string) bool {
+	for _, t := range c.Events {
+		if t == evType {
+			return true
+		}
+	}
+	return false
+}
+
+// body renders the delivery payload for one event.
+func (c *WebhookConfig) body(ev Event) ([]byte, error) {
+	if c.Body == "" {
+		return json.Marshal(ev)
+	}
+	// Values are JSON-escaped before interpolation so a quote in an
+	// instance name cannot break out of the template's strings.
+	esc := func(s string) string {
+		b, _ := json.Marshal(s)
+		return string(b[1 : len(b)-1])
+	}
+	return []byte(strings.NewReplacer(
+		"${type}", esc(ev.Type),
+		"${device}", esc(ev.Device),
+		"${iface}", esc(ev.Iface),
+		"${src_ip}", esc(ev.SrcIP),
+		"${summary}", esc(ev.Summary),
+		"${time}", esc(ev.Time.Format(time.RFC3339)),
+	).Replace(c.Body)), nil
+}
+
+// webhook is the runtime for one target; like exec hooks, one delivery
+// runs at a time and events arriving meanwhile are skipped and counted.
+type webhook struct {
+	cfg  *WebhookConfig
+	busy chan struct{}
+}
+
+// startNotifications subscribes the configured webhooks to the event bus.
+func startNotifications(cfg *Config, r *Reflector) {
+	if len(cfg.Notifications.Webhooks) == 0 {
+		return
+	}
+	hooks := make([]*webhook, len(cfg.Notifications.Webhooks))
+	for i := range cfg.Notifications.Webhooks {
+		hooks[i] = &webhook{cfg: &cfg.Notifications.Webhooks[i], busy: make(chan struct{}, 1)}
+	}
+	ch, _ := r.events.subscribe()
+	go func() {
+		for ev := range ch {
+			for _, h := range hooks {
+				if h.cfg.wants(ev.Type) {
+					h.deliver(ev)
+				}
+			}
+		}
+	}()
+	log.Printf("notifications: %d webhook(s) configured", len(hooks))
+}
+
+// deliver POSTs one event, unless a delivery is already in flight.
+func (h *webhook) deliver(ev Event) {
+	select {
+	case h.busy <- struct{}{}:
+	default:
+		metrics.Inc("mdns_webhook_skipped_total", nil)
+		return
+	}
+	go func() {
+		defer func() { <-h.busy }()
+		payload, err := h.cfg.body(ev)
+		if err != nil {
+			log.Printf("webhook: %v", err)
+			return
+		}
+		client := &http.Client{Timeout: time.Duration(h.cfg.TimeoutSeconds) * time.Second}
+		resp, err := client.Post(h.cfg.URL, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			metrics.Inc("mdns_webhook_errors_total", nil)
+			log.Printf("webhook: %s: %v", h.cfg.URL, err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			metrics.Inc("mdns_webhook_errors_total", nil)
+			log.Printf("webhook: %s returned %s", h.cfg.URL, resp.Status)
+			return
+		}
+		metrics.Inc("mdns_webhook_sent_total", nil)
+	}()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// Record ownership binding. On a single segment, mDNS name defense is
+// probing; across a reflector, the victim never hears the imposter's
+// probe and can't defend. So the reflector remembers which source first
+// announced each owner name — interface, IP and, when the neighbor table
+// has it, MAC — and a response in which a different source claims an
+// already-bound name is flagged, or dropped outright in drop mode. A
+// device that renumbers keeps its names as long as its MAC matches.
+
+// OwnershipConfig tunes the record-source binding check.
+type OwnershipConfig struct {
+	// Mode is "flag" (log, count, publish an event; the default),
+	// "drop" (additionally discard the conflicting response) or "off".
+	Mode string `yaml:"mode"`
+}
+
+// validate applies the default and rejects unknown modes.
+func (c *OwnershipConfig) validate() error {
+	switch c.Mode {
+	case "":
+		c.Mode = "flag"
+	case "flag", "drop", "off":
+	default:
+		return fmt.Errorf("ownership: unknown mode %q (want flag, drop or off)", c.Mode)
+	}
+	return nil
+}
+
+// ownershipCap bounds the binding table.
+const ownershipCap = 65536
+
+// recordOwner is the source bound to an owner name.
+type recordOwner struct {
+	iface string
+	ip    string
+	mac   string
+}
+
+type ownershipTable struct {
+	r  *Reflector
+	mu sync.Mutex
+	// owners maps a lowercased record owner name to its binding.
+	owners map[string]recordOwner
+}
+
+func newOwnershipTable(r *Reflector) *ownershipTable {
+	return &ownershipTable{r: r, owners: make(map[string]recordOwner)}
+}
+
+// check inspects a response's answer records against the binding table,
+// binding unclaimed names to the sender. It returns false when the
+// response claims someone else's name and the mode is drop.
+func (o *ownershipTable) check(pkt *packet, srcIface string) bool {
+	mode := o.r.config().Ownership.Mode
+	if mode == "off" || !pkt.msg.Response {
+		return true
+	}
+	src := pkt.src.IP.String()
+	mac := lookupMAC(pkt.src.IP)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, rr := range pkt.msg.Answer {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeOPT {
+			continue
+		}
+		name := strings.ToLower(hdr.Name)
+		if hdr.Ttl == 0 {
+			// A goodbye releases the binding; goodbyeGuard has already
+			// vetted that the sender may say it.
+			delete(o.owners, name)
+			continue
+		}
+		owner, bound := o.owners[name]
+		if !bound {
+			if len(o.owners) >= ownershipCap {
+				o.owners = make(map[string]recordOwner)
+			}
+			o.owners[name] = recordOwner{iface: srcIface, ip: src, mac: mac}
+			continue
+		}
+		if owner.ip == src && owner.iface == srcIface {
+			continue
+		}
+		if mac != "" && owner.mac == mac {
+			// Same device, new address or segment: rebind.
+			o.owners[name] = recordOwner{iface: srcIface, ip: src, mac: mac}
+			continue
+		}
+		metrics.Inc("mdns_ownership_conflicts_total", Labels{"iface": srcIface})
+		log.Printf("ownership: %s on %s claims %s, bound to %s on %s",
+			src, srcIface, hdr.Name, owner.ip, owner.iface)
+		o.r.events.publish(Event{
+			Type:    "ownership-conflict",
+			Iface:   srcIface,
+			SrcIP:   src,
+			Summary: hdr.Name + " is bound to " + owner.ip + " on " + owner.iface,
+		})
+		if mode == "drop" {
+			metrics.Inc("mdns_ownership_dropped_total", Labels{"iface": srcIface})
+			return false
+		}
+	}
+	return true
+}
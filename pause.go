@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// Reflection pause. When reflection is suspected of causing a network
+// incident the operator needs a brake that takes effect immediately and
+// loses nothing: listeners stay open, state (windows, inventory, dedup)
+// keeps accumulating, only forwarding stops. Toggled over the API or by
+// sending the process SIGUSR2 — the latter works when the API itself is
+// unreachable.
+
+// setPaused flips the forwarding brake and reports the new state.
+func (r *Reflector) setPaused(paused bool) {
+	was := r.paused.Swap(paused)
+	if was == paused {
+		return
+	}
+	state := "resumed"
+	if paused {
+		state = "paused"
+	}
+	log.Printf("reflection %s", state)
+	if paused {
+		metrics.Set("mdns_paused", nil, 1)
+	} else {
+		metrics.Set("mdns_paused", nil, 0)
+	}
+	r.events.publish(Event{Type: "pause", Summary: "reflection " + state})
+}
+
+// pauseDrops is the forwarding-path gate; every suppressed packet is
+// counted so the pause shows up on dashboards.
+func (r *Reflector) pauseDrops() bool {
+	if !r.paused.Load() {
+		return false
+	}
+	metrics.Inc("mdns_pause_suppressed_total", nil)
+	return true
+}
+
+// startPauseSignal toggles the pause on SIGUSR2.
+func startPauseSignal(r *Reflector) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, unix.SIGUSR2)
+	go func() {
+		for range ch {
+			r.setPaused(!r.paused.Load())
+		}
+	}()
+}
+
+// pauseHandler reports and changes the pause state:
+//
+//	GET  /pause                  – current state
+//	POST /pause {"paused": true} – pause or resume
+func (a *apiServer) pauseHandler(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body struct {
+			Paused bool `json:"paused"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.r.setPaused(body.Paused)
+	default:
+		http.Error(w, "GET or POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Paused bool `json:"paused"`
+	}{a.r.paused.Load()})
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Site-to-site reflection. Multicast does not traverse a routed VPN, so
+// browsing AirPlay at a second site needs the two reflectors to carry
+// packets for each other. A peer is a long-lived TCP connection (TLS
+// optional) to another mdns-reflector; in the rules it behaves like any
+// other group, so `to: [site-b]` ships matching packets to the remote
+// instance and rules there with `from: site-b` decide which local VLANs
+// hear them. Frames are a 2-byte length prefix plus the raw mDNS payload.
+
+// PeerConfig describes one remote reflector. One side listens, the other
+// connects; the dialer reconnects forever.
+type PeerConfig struct {
+	Name string `yaml:"name"`
+	// Connect is the remote host:port to dial.
+	Connect string `yaml:"connect"`
+	// Listen is a local address to accept the peer on instead.
+	Listen string `yaml:"listen"`
+	// CertFile and KeyFile enable TLS with this identity.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// CAFile pins the CA the remote certificate must chain to.
+	CAFile string `yaml:"ca_file"`
+	// Insecure skips certificate verification when dialing.
+	Insecure bool `yaml:"insecure"`
+}
+
+// validate checks one peer entry.
+func (p *PeerConfig) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("peer has no name")
+	}
+	if p.Connect == "" && p.Listen == "" {
+		return fmt.Errorf("peer %q: need connect or listen", p.Name)
+	}
+	if p.Connect != "" && p.Listen != "" {
+		return fmt.Errorf("peer %q: connect and listen are mutually exclusive", p.Name)
+	}
+	if (p.CertFile == "") != (p.KeyFile == "") {
+		return fmt.Errorf("peer %q: cert_file and key_file go together", p.Name)
+	}
+	return nil
+}
+
+// peerMaxFrame bounds a received frame; nothing legitimate on this wire
+// exceeds a jumbo datagram.
+const peerMaxFrame = 9000
+
+// peerRedialInterval paces reconnect attempts.
+const peerRedialInterval = 10 * time.Second
+
+type peerSet struct {
+	r     *Reflector
+	mu    sync.Mutex
+	conns map[string]net.Conn
+}
+
+func newPeerSet(r *Reflector) *peerSet {
+	return &peerSet{r: r, conns: make(map[string]net.Conn)}
+}
+
+// run starts the listeners and dialers for every configured peer.
+func (p *peerSet) run() {
+	cfg := p.r.config()
+	for i := range cfg.Peers {
+		pc := cfg.Peers[i]
+		if pc.Listen != "" {
+			go p.listenLoop(pc)
+		} else {
+			go p.dialLoop(pc)
+		}
+	}
+}
+
+// tlsConfig builds the TLS setup for a peer, or nil for plain TCP.
+func peerTLSConfig(pc PeerConfig, server bool) (*tls.Config, error) {
+	if pc.CertFile == "" && pc.CAFile == "" && !pc.Insecure {
+		return nil, nil
+	}
+	tc := &tls.Config{InsecureSkipVerify: pc.Insecure}
+	if pc.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(pc.CertFile, pc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("peer %q: %w", pc.Name, err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	if pc.CAFile != "" {
+		pem, err := os.ReadFile(pc.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("peer %q: %w", pc.Name, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("peer %q: no certificates in %s", pc.Name, pc.CAFile)
+		}
+		if server {
+			tc.ClientCAs = pool
+			tc.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			tc.RootCAs = pool
+		}
+	}
+	return tc, nil
+}
+
+// listenLoop accepts the remote peer; a new connection replaces the old.
+func (p *peerSet) listenLoop(pc PeerConfig) {
+	tc, err := peerTLSConfig(pc, true)
+	if err != nil {
+		log.Printf("peer %s: %v", pc.Name, err)
+		return
+	}
+	ln, err := net.Listen("tcp", pc.Listen)
+	if err != nil {
+		log.Printf("peer %s: listen on %s: %v", pc.Name, pc.Listen, err)
+		return
+	}
+	if tc != nil {
+		ln = tls.NewListener(ln, tc)
+	}
+	log.Printf("peer %s: listening on %s", pc.Name, pc.Listen)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("peer %s: accept: %v", pc.Name, err)
+			return
+		}
+		log.Printf("peer %s: connected from %s", pc.Name, conn.RemoteAddr())
+		p.adopt(pc.Name, conn)
+		go p.readLoop(pc.Name, conn)
+	}
+}
+
+// dialLoop keeps one connection to the remote up, redialing on loss.
+func (p *peerSet) dialLoop(pc PeerConfig) {
+	tc, err := peerTLSConfig(pc, false)
+	if err != nil {
+		log.Printf("peer %s: %v", pc.Name, err)
+		return
+	}
+	for {
+		var conn net.Conn
+		if tc != nil {
+			conn, err = tls.Dial("tcp", pc.Connect, tc)
+		} else {
+			conn, err = net.DialTimeout("tcp", pc.Connect, peerRedialInterval)
+		}
+		if err != nil {
+			log.Printf("peer %s: dial %s: %v", pc.Name, pc.Connect, err)
+			time.Sleep(peerRedialInterval)
+			continue
+		}
+		log.Printf("peer %s: connected to %s", pc.Name, pc.Connect)
+		p.adopt(pc.Name, conn)
+		p.readLoop(pc.Name, conn)
+		time.Sleep(peerRedialInterval)
+	}
+}
+
+// adopt installs a connection, closing any predecessor.
+func (p *peerSet) adopt(name string, conn net.Conn) {
+	p.mu.Lock()
+	if old := p.conns[name]; old != nil {
+		old.Close()
+	}
+	p.conns[name] = conn
+	p.mu.Unlock()
+}
+
+// readLoop delivers inbound frames until the connection dies.
+func (p *peerSet) readLoop(name string, conn net.Conn) {
+	defer func() {
+		p.mu.Lock()
+		if p.conns[name] == conn {
+			delete(p.conns, name)
+		}
+		p.mu.Unlock()
+		conn.Close()
+	}()
+	src := &net.UDPAddr{Port: mdnsGroup.Port}
+	if ta, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		src.IP = ta.IP
+	}
+	var hdr [2]byte
+	for {
+		if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+			log.Printf("peer %s: connection lost: %v", name, err)
+			return
+		}
+		n := int(binary.BigEndian.Uint16(hdr[:]))
+		if n == 0 || n > peerMaxFrame {
+			log.Printf("peer %s: bad frame length %d", name, n)
+			return
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			log.Printf("peer %s: connection lost: %v", name, err)
+			return
+		}
+		metrics.Inc("mdns_peer_received_total", Labels{"peer": name})
+		p.r.handlePeerPacket(name, payload, src)
+	}
+}
+
+// send ships one payload to a peer; without a live connection the packet
+// is dropped, mDNS being best-effort either way.
+func (p *peerSet) send(name string, wire []byte) {
+	if len(wire) > peerMaxFrame {
+		return
+	}
+	p.mu.Lock()
+	conn := p.conns[name]
+	p.mu.Unlock()
+	if conn == nil {
+		metrics.Inc("mdns_peer_dropped_total", Labels{"peer": name})
+		return
+	}
+	frame := make([]byte, 2+len(wire))
+	binary.BigEndian.PutUint16(frame, uint16(len(wire)))
+	copy(frame[2:], wire)
+	conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write(frame); err != nil {
+		log.Printf("peer %s: write: %v", name, err)
+		p.mu.Lock()
+		if p.conns[name] == conn {
+			delete(p.conns, name)
+		}
+		p.mu.Unlock()
+		conn.Close()
+		metrics.Inc("mdns_peer_dropped_total", Labels{"peer": name})
+		return
+	}
+	metrics.Inc("mdns_peer_sent_total", Labels{"peer": name})
+}
+
+// handlePeerPacket runs a frame from a peer through the rules, with the
+// peer standing in as the source group. Peer-to-peer relay is refused so
+// two sites cannot ping-pong a packet.
+func (r *Reflector) handlePeerPacket(peerName string, payload []byte, src *net.UDPAddr) {
+	pkt, err := parsePacket(payload, src, 0)
+	if err != nil {
+		r.reportError(errParse, "dropping unparseable packet from peer "+peerName, err)
+		return
+	}
+	srcIface := "peer:" + peerName
+	cfg := r.config()
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.From != peerName {
+			continue
+		}
+		if !rule.Filter.match(pkt) {
+			continue
+		}
+		dsts := r.ruleDestinations(rule, srcIface)
+		kept := dsts[:0]
+		for _, d := range dsts {
+			if !strings.HasPrefix(d, "peer:") {
+				kept = append(kept, d)
+			}
+		}
+		dsts = r.fanout.cap(kept, rule.MaxFanout, rule.label(i))
+		if len(dsts) == 0 {
+			continue
+		}
+		r.forwardLogged(pkt, srcIface, dsts, rule.label(i), rule.Log)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net"
+	"time"
+)
+
+// rxMeta is what the kernel attached to one received datagram; any field
+// may be zero when the platform or socket options do not provide it.
+type rxMeta struct {
+	ifindex int
+	kstamp  time.Time
+	ttl     int
+	dst     net.IP
+}
+
+// sockOps isolates platform-dependent socket behavior — control-message
+// decoding, receive timestamps, bind-to-device — behind one seam. Per-OS
+// implementations attach to nativeSockOps in build-tagged files, and a
+// test can swap sys for a mock instead of scattering build tags through
+// the packet path.
+type sockOps interface {
+	// EnableRxTimestamps asks the kernel to attach receive timestamps
+	// to datagrams, where supported.
+	EnableRxTimestamps(uc *net.UDPConn) error
+	// ParseOOB extracts the receiving interface index, kernel
+	// timestamp, IP TTL and destination address from socket control
+	// messages; any may be absent.
+	ParseOOB(oob []byte) rxMeta
+	// BindToDevice scopes a socket to one device (SO_BINDTODEVICE),
+	// used for VRFs.
+	BindToDevice(uc *net.UDPConn, device string) error
+	// InheritedConn adopts a listening socket handed over from a
+	// previous process (systemd fd store), or returns nil.
+	InheritedConn(name string) *net.UDPConn
+	// StoreConn hands a listening socket to the process supervisor so
+	// the next process can inherit it.
+	StoreConn(name string, uc *net.UDPConn) error
+	// WatchLinks subscribes to kernel link up/down/removal events,
+	// calling cb from a background goroutine; see hotplug.go.
+	WatchLinks(cb func(linkEvent)) error
+}
+
+// nativeSockOps is the real implementation for the build platform.
+type nativeSockOps struct{}
+
+// sys is the active socket-operations implementation.
+var sys sockOps = nativeSockOps{}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Poison detection by record history. The ownership table (ownership.go)
+// binds names to sources; this guard watches the values. A poisoned
+// record has a recognizable arc: a name that has answered with one value
+// for days suddenly answers with an implausible one — from a different
+// subnet, a different MAC — and when the real device next announces, the
+// value snaps back. Keeping a short history of values per owner name
+// makes both halves visible: the implausible change is flagged (or
+// suppressed in drop mode) as it happens, and the revert confirms the
+// earlier change was not a legitimate renumbering.
+
+// PoisonGuardConfig tunes the record-value history check.
+type PoisonGuardConfig struct {
+	// Mode is "off" (the default), "flag" (log, count, publish events)
+	// or "drop" (additionally discard responses carrying a suspicious
+	// value change).
+	Mode string `yaml:"mode"`
+	// Depth is how many values are remembered per record; default 4.
+	Depth int `yaml:"depth"`
+}
+
+// validate applies defaults and rejects unknown modes.
+func (c *PoisonGuardConfig) validate() error {
+	switch c.Mode {
+	case "", "off":
+		c.Mode = "off"
+	case "flag", "drop":
+	default:
+		return fmt.Errorf("poison_guard: unknown mode %q (want off, flag or drop)", c.Mode)
+	}
+	if c.Depth <= 0 {
+		c.Depth = 4
+	}
+	return nil
+}
+
+// poisonCap bounds the history table.
+const poisonCap = 65536
+
+// recordVersion is one remembered value of a record.
+type recordVersion struct {
+	Value   string    `json:"value"`
+	SrcIP   string    `json:"src_ip"`
+	MAC     string    `json:"mac,omitempty"`
+	Iface   string    `json:"iface"`
+	Time    time.Time `json:"time"`
+	Suspect bool      `json:"suspect,omitempty"`
+}
+
+type poisonGuard struct {
+	r  *Reflector
+	mu sync.Mutex
+	// hist maps "name|type" to its value history, newest last.
+	hist map[string][]recordVersion
+}
+
+func newPoisonGuard(r *Reflector) *poisonGuard {
+	return &poisonGuard{r: r, hist: make(map[string][]recordVersion)}
+}
+
+// rdataString renders a record's value without its header, so TTL
+// refreshes don't read as changes.
+func rdataString(rr dns.RR) string {
+	return strings.TrimSpace(strings.TrimPrefix(rr.String(), rr.Header().String()))
+}
+
+// sameSubnet reports whether two addresses plausibly share a segment:
+// /24 for IPv4, /64 for IPv6. Coarse, but renumbering within a VLAN
+// stays inside these prefixes and an injected off-net value does not.
+func sameSubnet(a, b net.IP) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if a4, b4 := a.To4(), b.To4(); a4 != nil && b4 != nil {
+		return a4.Mask(net.CIDRMask(24, 32)).Equal(b4.Mask(net.CIDRMask(24, 32)))
+	}
+	if a.To4() != nil || b.To4() != nil {
+		return false
+	}
+	return a.Mask(net.CIDRMask(64, 128)).Equal(b.Mask(net.CIDRMask(64, 128)))
+}
+
+// check folds a response's answer records into the history, flagging
+// implausible value changes and reverts. It returns false when the
+// response carries a suspicious change and the mode is drop.
+func (g *poisonGuard) check(pkt *packet, srcIface string) bool {
+	cfg := g.r.config().PoisonGuard
+	if cfg.Mode == "off" || !pkt.msg.Response {
+		return true
+	}
+	src := pkt.src.IP.String()
+	mac := lookupMAC(pkt.src.IP)
+	suspicious := false
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, rr := range pkt.msg.Answer {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeOPT || hdr.Ttl == 0 {
+			continue
+		}
+		key := strings.ToLower(hdr.Name) + "|" + dns.TypeToString[hdr.Rrtype]
+		value := rdataString(rr)
+		versions := g.hist[key]
+		if len(versions) == 0 {
+			if len(g.hist) >= poisonCap {
+				g.hist = make(map[string][]recordVersion)
+			}
+			g.hist[key] = []recordVersion{{Value: value, SrcIP: src, MAC: mac, Iface: srcIface, Time: time.Now()}}
+			continue
+		}
+		latest := &versions[len(versions)-1]
+		if value == latest.Value {
+			latest.Time = time.Now()
+			continue
+		}
+		// A value change from the same device (MAC match) or the same
+		// subnet is ordinary churn; a change from elsewhere is not.
+		suspect := !sameSubnet(pkt.src.IP, net.ParseIP(latest.SrcIP)) &&
+			(mac == "" || latest.MAC == "" || mac != latest.MAC)
+		if latest.Suspect && !suspect {
+			for _, v := range versions[:len(versions)-1] {
+				if v.Value == value && !v.Suspect {
+					metrics.Inc("mdns_poison_reverts_total", Labels{"iface": srcIface})
+					log.Printf("poison: %s reverted to %s after suspect value %q from %s",
+						hdr.Name, value, latest.Value, latest.SrcIP)
+					g.r.events.publish(Event{
+						Type:    "poison-revert",
+						Iface:   srcIface,
+						SrcIP:   src,
+						Summary: fmt.Sprintf("%s reverted after suspect change from %s", hdr.Name, latest.SrcIP),
+					})
+					break
+				}
+			}
+		}
+		versions = append(versions, recordVersion{
+			Value: value, SrcIP: src, MAC: mac, Iface: srcIface,
+			Time: time.Now(), Suspect: suspect,
+		})
+		if len(versions) > cfg.Depth {
+			versions = versions[len(versions)-cfg.Depth:]
+		}
+		g.hist[key] = versions
+		if suspect {
+			suspicious = true
+			metrics.Inc("mdns_poison_suspects_total", Labels{"iface": srcIface})
+			log.Printf("poison: %s changed %s to %q, announced from %s (was %s)",
+				src, hdr.Name, value, srcIface, versions[len(versions)-2].SrcIP)
+			g.r.events.publish(Event{
+				Type:    "poison-suspect",
+				Iface:   srcIface,
+				SrcIP:   src,
+				Summary: fmt.Sprintf("%s %s changed to implausible value from %s", hdr.Name, dns.TypeToString[hdr.Rrtype], src),
+			})
+		}
+	}
+	if suspicious && cfg.Mode == "drop" {
+		metrics.Inc("mdns_poison_dropped_total", Labels{"iface": srcIface})
+		return false
+	}
+	return true
+}
+
+// snapshot returns the history, optionally limited to one owner name.
+func (g *poisonGuard) snapshot(name string) map[string][]recordVersion {
+	name = strings.ToLower(name)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make(map[string][]recordVersion)
+	for key, versions := range g.hist {
+		if name != "" && !strings.HasPrefix(key, name+"|") {
+			continue
+		}
+		out[key] = append([]recordVersion{}, versions...)
+	}
+	return out
+}
+
+// recordsHandler exposes the value history:
+// GET /records/history, optionally filtered by ?name=.
+func (a *apiServer) recordsHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.r.poison.snapshot(req.URL.Query().Get("name")))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Payload anonymization for shareable debugging data. Logs, the event
+// stream and the history ring all carry hostnames, instance names and IPs
+// — a complete inventory of the household. Each sink can independently be
+// set to "hash" (stable opaque tokens, so correlation across lines still
+// works) or "truncate" (lossy but human-scannable); the wire reflection
+// path is never touched.
+
+// PrivacyConfig selects an anonymization mode per sink. Valid modes are
+// "" (off), "hash" and "truncate".
+type PrivacyConfig struct {
+	Logs    string `yaml:"logs"`
+	Events  string `yaml:"events"`
+	Ship    string `yaml:"ship"`
+	History string `yaml:"history"`
+}
+
+// validate rejects unknown modes.
+func (c *PrivacyConfig) validate() error {
+	for sink, mode := range map[string]string{
+		"logs": c.Logs, "events": c.Events, "ship": c.Ship, "history": c.History,
+	} {
+		switch mode {
+		case "", "hash", "truncate":
+		default:
+			return fmt.Errorf("privacy.%s: unknown mode %q (use hash or truncate)", sink, mode)
+		}
+	}
+	return nil
+}
+
+// scrubName anonymizes the instance/host part of a DNS name, preserving
+// the service-type and .local suffix that make the line interpretable.
+func scrubName(name, mode string) string {
+	if mode == "" {
+		return name
+	}
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i, l := range labels {
+		if l == "local" || strings.HasPrefix(l, "_") {
+			continue
+		}
+		switch mode {
+		case "hash":
+			sum := sha256.Sum256([]byte(l))
+			labels[i] = "h-" + hex.EncodeToString(sum[:4])
+		case "truncate":
+			if len(l) > 2 {
+				labels[i] = l[:2] + "…"
+			}
+		}
+	}
+	out := strings.Join(labels, ".")
+	if strings.HasSuffix(name, ".") {
+		out += "."
+	}
+	return out
+}
+
+// scrubIP anonymizes an IP: hashed to a stable token, or truncated to its
+// subnet.
+func scrubIP(ip, mode string) string {
+	switch mode {
+	case "hash":
+		sum := sha256.Sum256([]byte(ip))
+		return "ip-" + hex.EncodeToString(sum[:4])
+	case "truncate":
+		if i := strings.LastIndexByte(ip, '.'); i > 0 {
+			return ip[:i] + ".x"
+		}
+		if i := strings.LastIndexByte(ip, ':'); i > 0 {
+			return ip[:i] + ":x"
+		}
+	}
+	return ip
+}
+
+// scrubText anonymizes the names and addresses inside a free-form summary
+// line, leaving its structure (record types, counts) readable.
+func scrubText(text, mode string) string {
+	if mode == "" {
+		return text
+	}
+	fields := strings.Fields(text)
+	for i, f := range fields {
+		trimmed := strings.Trim(f, ",;()[]")
+		switch {
+		case net.ParseIP(trimmed) != nil:
+			fields[i] = strings.Replace(f, trimmed, scrubIP(trimmed, mode), 1)
+		case strings.Contains(trimmed, ".local"):
+			fields[i] = strings.Replace(f, trimmed, scrubName(trimmed, mode), 1)
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// scrubEvent returns a copy of an event with its identifying fields
+// anonymized for one sink.
+func scrubEvent(ev Event, mode string) Event {
+	if mode == "" {
+		return ev
+	}
+	ev.SrcIP = scrubIP(ev.SrcIP, mode)
+	ev.Device = ""
+	ev.Summary = scrubText(ev.Summary, mode)
+	return ev
+}
@@ -0,0 +1,56 @@
+package main
+
+import "sort"
+
+// profiles maps an application profile name to the set of service types the
+// application needs for discovery to work end to end. Referencing a profile
+// in a filter is equivalent to listing all of its services in
+// allowed_services.
+var profiles = map[string][]string{
+	// AirPlay audio/video targets, including the AirPlay 2 RAOP channel.
+	"airplay": {
+		"_airplay._tcp",
+		"_raop._tcp",
+	},
+	// Google Cast (Chromecast, Google/Nest speakers and displays).
+	"cast": {
+		"_googlecast._tcp",
+	},
+	// Sonos speakers. Modern Sonos firmware announces over mDNS
+	// (_sonos._tcp plus _spotify-connect._tcp for direct Spotify
+	// playback), but the official apps still locate households via SSDP
+	// M-SEARCH for the ZonePlayer device type, so this profile also
+	// activates the SSDP reflector (see ssdp.go) for rules that
+	// reference it.
+	"sonos": {
+		"_sonos._tcp",
+		"_spotify-connect._tcp",
+	},
+	// Driverless (IPP Everywhere / AirPrint) printing and scanning.
+	// _pdl-datastream covers legacy raw port-9100 printing, _uscan the
+	// eSCL scanner channel; all four are needed for a printer to be fully
+	// usable across segments.
+	"printers": {
+		"_ipp._tcp",
+		"_ipps._tcp",
+		"_uscan._tcp",
+		"_pdl-datastream._tcp",
+	},
+}
+
+// profileSSDPTargets maps a profile to the UPnP search targets its
+// ecosystem discovers over SSDP; most profiles are mDNS-only.
+var profileSSDPTargets = map[string][]string{
+	"sonos": {"urn:schemas-upnp-org:device:ZonePlayer:1"},
+}
+
+// profileNames returns the defined profile names, sorted for stable error
+// messages.
+func profileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestPrintersProfileServices(t *testing.T) {
+	f := Filter{Profiles: []string{"printers"}}
+	if err := f.compile(); err != nil {
+		t.Fatal(err)
+	}
+	for _, svc := range []string{"_ipp._tcp", "_ipps._tcp", "_uscan._tcp", "_pdl-datastream._tcp"} {
+		if !f.services[svc] {
+			t.Errorf("printers profile missing %s", svc)
+		}
+	}
+}
+
+// A reflected printer response must arrive byte-identical: clients parse the
+// rp= and pdl= TXT keys to set up driverless printing, and any repacking
+// risk (name compression, key reordering) is unacceptable.
+func TestReflectedResponsePreservesTXT(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Response = true
+	msg.Answer = append(msg.Answer,
+		&dns.PTR{
+			Hdr: dns.RR_Header{Name: "_ipp._tcp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 4500},
+			Ptr: "Office Printer._ipp._tcp.local.",
+		},
+		&dns.TXT{
+			Hdr: dns.RR_Header{Name: "Office Printer._ipp._tcp.local.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 4500},
+			Txt: []string{"rp=ipp/print", "pdl=application/pdf,image/urf", "URF=W8,SRGB24"},
+		},
+	)
+	payload, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 19, 40), Port: 5353}
+	pkt, err := parsePacket(payload, src, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wire, err := pkt.wire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(wire, payload) {
+		t.Fatal("response payload was modified by reflection")
+	}
+
+	svcs := pkt.services()
+	found := false
+	for _, s := range svcs {
+		if s == "_ipp._tcp" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("services() = %v, want _ipp._tcp", svcs)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// QuietHoursConfig suppresses reflection on a schedule, for deployments
+// where nighttime multicast wakes battery devices or violates building
+// policies. Configured globally or per destination group; a group's
+// schedule overrides the global one.
+type QuietHoursConfig struct {
+	// From and To are local wall-clock times "HH:MM"; a window may wrap
+	// midnight ("23:00" to "07:00").
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Mode is "all" (the default: suppress everything) or
+	// "announcements" (suppress only unsolicited announcements; queries
+	// and solicited responses still flow).
+	Mode string `yaml:"mode"`
+
+	fromMin, toMin int
+}
+
+func (q *QuietHoursConfig) enabled() bool { return q.From != "" || q.To != "" }
+
+func (q *QuietHoursConfig) compile() error {
+	if !q.enabled() {
+		return nil
+	}
+	var err error
+	if q.fromMin, err = parseWallClock(q.From); err != nil {
+		return fmt.Errorf("quiet_hours: from: %w", err)
+	}
+	if q.toMin, err = parseWallClock(q.To); err != nil {
+		return fmt.Errorf("quiet_hours: to: %w", err)
+	}
+	switch q.Mode {
+	case "", "all", "announcements":
+	default:
+		return fmt.Errorf("quiet_hours: unknown mode %q", q.Mode)
+	}
+	return nil
+}
+
+// parseWallClock converts "HH:MM" to minutes since midnight.
+func parseWallClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// active reports whether now falls inside the quiet window.
+func (q *QuietHoursConfig) active(now time.Time) bool {
+	if !q.enabled() {
+		return false
+	}
+	min := now.Hour()*60 + now.Minute()
+	if q.fromMin <= q.toMin {
+		return min >= q.fromMin && min < q.toMin
+	}
+	// Window wraps midnight.
+	return min >= q.fromMin || min < q.toMin
+}
+
+// quietSuppresses reports whether quiet hours block this packet toward a
+// destination group.
+func (r *Reflector) quietSuppresses(pkt *packet, g *Group, now time.Time) bool {
+	q := &r.config().QuietHours
+	if g != nil && g.QuietHours.enabled() {
+		q = &g.QuietHours
+	}
+	if !q.active(now) {
+		return false
+	}
+	if q.Mode == "announcements" && pkt.class() != "announcement" {
+		return false
+	}
+	groupName := ""
+	if g != nil {
+		groupName = g.Name
+	}
+	metrics.Inc("mdns_quiet_suppressed_total", Labels{"group": groupName})
+	return true
+}
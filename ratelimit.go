@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Per-rule source rate limiting. One chatty IoT device can saturate
+// every destination VLAN of a rule; byte budgets (budget.go) protect the
+// destinations in aggregate, but the flooding device also starves its
+// well-behaved neighbors of the shared budget. A rule-level token bucket
+// per source IP caps each device individually: tokens refill at the
+// configured rate, a packet spends one, and an empty bucket drops the
+// packet with a counted, logged decision.
+
+// RateLimitConfig is a rule's rate_limit block.
+type RateLimitConfig struct {
+	// PerSource is the sustained packet rate allowed per source IP,
+	// written as "20/s" or "300/m". Empty disables the limiter.
+	PerSource string `yaml:"per_source"`
+	// Burst is how many tokens a bucket holds; defaults to the
+	// per-second rate, with a floor of 1.
+	Burst int `yaml:"burst"`
+
+	rate float64 // tokens per second, compiled
+}
+
+// compile parses the rate expression.
+func (c *RateLimitConfig) compile() error {
+	if c.PerSource == "" {
+		return nil
+	}
+	num, unit, ok := strings.Cut(c.PerSource, "/")
+	if !ok {
+		return fmt.Errorf("rate_limit: per_source %q: want N/s or N/m", c.PerSource)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(num))
+	if err != nil || n <= 0 {
+		return fmt.Errorf("rate_limit: per_source %q: bad count", c.PerSource)
+	}
+	switch strings.TrimSpace(unit) {
+	case "s":
+		c.rate = float64(n)
+	case "m":
+		c.rate = float64(n) / 60
+	default:
+		return fmt.Errorf("rate_limit: per_source %q: unit must be s or m", c.PerSource)
+	}
+	if c.Burst <= 0 {
+		c.Burst = int(c.rate)
+		if c.Burst < 1 {
+			c.Burst = 1
+		}
+	}
+	return nil
+}
+
+// rateBucketsCap bounds the per-rule bucket tables; a full table resets,
+// briefly refilling everyone.
+const rateBucketsCap = 4096
+
+// rateBucket is one source's token bucket.
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitSet holds the bucket tables for every rate-limited rule,
+// keyed by rule label so state survives config reloads.
+type rateLimitSet struct {
+	r      *Reflector
+	mu     sync.Mutex
+	byRule map[string]map[string]*rateBucket
+}
+
+func newRateLimitSet(r *Reflector) *rateLimitSet {
+	return &rateLimitSet{r: r, byRule: make(map[string]map[string]*rateBucket)}
+}
+
+// allow spends one token from the bucket for (rule, source), refilling
+// first. A drop is counted and, in debug mode, logged once per drop.
+func (s *rateLimitSet) allow(cfg *RateLimitConfig, ruleLabel, src string) bool {
+	if cfg.rate == 0 {
+		return true
+	}
+	now := s.r.clk.Now()
+	s.mu.Lock()
+	buckets := s.byRule[ruleLabel]
+	if buckets == nil {
+		buckets = make(map[string]*rateBucket)
+		s.byRule[ruleLabel] = buckets
+	}
+	b := buckets[src]
+	if b == nil {
+		if len(buckets) >= rateBucketsCap {
+			buckets = make(map[string]*rateBucket)
+			s.byRule[ruleLabel] = buckets
+		}
+		b = &rateBucket{tokens: float64(cfg.Burst), last: now}
+		buckets[src] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * cfg.rate
+	if b.tokens > float64(cfg.Burst) {
+		b.tokens = float64(cfg.Burst)
+	}
+	b.last = now
+	ok := b.tokens >= 1
+	if ok {
+		b.tokens--
+	}
+	s.mu.Unlock()
+	if !ok {
+		metrics.Inc("mdns_ratelimited_total", Labels{"rule": ruleLabel})
+		if s.r.config().Debug {
+			log.Printf("rate limit: dropping packet from %s on rule %s", src, ruleLabel)
+		}
+	}
+	return ok
+}
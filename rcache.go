@@ -0,0 +1,203 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Passive record cache. Every reflected response is an answer somebody on
+// another VLAN will ask for again within its TTL; reflecting that repeat
+// query to the device VLAN and waking every device there is pure waste.
+// With the cache enabled, answer records are retained until their TTL
+// expires (honoring the RFC 6762 cache-flush bit and TTL-0 goodbyes) and
+// a query fully answerable from cache is answered locally on its own
+// VLAN instead of being reflected.
+
+// RecordCacheConfig enables the passive answer cache.
+type RecordCacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxRecords bounds the cache; default 10000.
+	MaxRecords int `yaml:"max_records"`
+}
+
+// cachedRecord is one answer record with its expiry.
+type cachedRecord struct {
+	rr      dns.RR
+	expires time.Time
+}
+
+// recordCache holds answer records keyed by (name, type); class is always
+// IN on this wire.
+type recordCache struct {
+	cfg   *RecordCacheConfig
+	clk   clock
+	mu    sync.Mutex
+	byKey map[string][]cachedRecord
+	count int
+}
+
+func newRecordCache(cfg *RecordCacheConfig) *recordCache {
+	if cfg.MaxRecords <= 0 {
+		cfg.MaxRecords = 10000
+	}
+	return &recordCache{cfg: cfg, clk: realClock{}, byKey: make(map[string][]cachedRecord)}
+}
+
+// cacheKey identifies a record set.
+func cacheKey(name string, rrtype uint16) string {
+	return strings.ToLower(name) + "\x00" + strconv.Itoa(int(rrtype))
+}
+
+// observe folds a response's records into the cache. A record with the
+// cache-flush bit replaces the whole set for its name and type; a TTL of
+// zero is a goodbye and evicts the set.
+func (c *recordCache) observe(pkt *packet) {
+	if !c.cfg.Enabled || !pkt.msg.Response {
+		return
+	}
+	now := c.clk.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rr := range append(append([]dns.RR{}, pkt.msg.Answer...), pkt.msg.Extra...) {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeOPT {
+			continue
+		}
+		key := cacheKey(hdr.Name, hdr.Rrtype)
+		if hdr.Ttl == 0 {
+			c.count -= len(c.byKey[key])
+			delete(c.byKey, key)
+			continue
+		}
+		flush := hdr.Class&classQU != 0
+		entry := cachedRecord{rr: rr, expires: now.Add(time.Duration(hdr.Ttl) * time.Second)}
+		set := c.byKey[key]
+		if flush {
+			c.count -= len(set)
+			set = set[:0]
+		} else {
+			// Same rdata refreshes in place.
+			rendered := rr.String()
+			replaced := false
+			for i := range set {
+				if set[i].rr.String() == rendered {
+					set[i] = entry
+					replaced = true
+					break
+				}
+			}
+			if replaced {
+				c.byKey[key] = set
+				continue
+			}
+		}
+		set = append(set, entry)
+		c.byKey[key] = set
+		c.count++
+	}
+	if c.count > c.cfg.MaxRecords {
+		c.sweep(now)
+	}
+	metrics.Set("mdns_cache_records", nil, float64(c.count))
+}
+
+// sweep drops expired records; the caller holds c.mu.
+func (c *recordCache) sweep(now time.Time) {
+	for key, set := range c.byKey {
+		kept := set[:0]
+		for _, e := range set {
+			if e.expires.After(now) {
+				kept = append(kept, e)
+			}
+		}
+		c.count -= len(set) - len(kept)
+		if len(kept) == 0 {
+			delete(c.byKey, key)
+		} else {
+			c.byKey[key] = kept
+		}
+	}
+}
+
+// answer builds a response when every question in a query can be answered
+// from unexpired cache, or returns nil. Answers carry the remaining TTL
+// so downstream caches expire in step with the origin.
+func (c *recordCache) answer(pkt *packet) *dns.Msg {
+	if !c.cfg.Enabled || pkt.msg.Response {
+		return nil
+	}
+	now := c.clk.Now()
+	resp := new(dns.Msg)
+	resp.Response = true
+	resp.Authoritative = true
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, q := range pkt.msg.Question {
+		found := false
+		keys := []string{cacheKey(q.Name, q.Qtype)}
+		if q.Qtype == dns.TypeANY {
+			keys = nil
+			prefix := strings.ToLower(q.Name) + "\x00"
+			for key := range c.byKey {
+				if strings.HasPrefix(key, prefix) {
+					keys = append(keys, key)
+				}
+			}
+		}
+		for _, key := range keys {
+			for _, e := range c.byKey[key] {
+				if !e.expires.After(now) {
+					continue
+				}
+				rr := dns.Copy(e.rr)
+				rr.Header().Ttl = uint32(e.expires.Sub(now) / time.Second)
+				rr.Header().Class = dns.ClassINET
+				resp.Answer = append(resp.Answer, rr)
+				found = true
+			}
+		}
+		if !found {
+			// A partially answerable query still has to travel.
+			return nil
+		}
+	}
+	if len(resp.Answer) == 0 {
+		return nil
+	}
+	return resp
+}
+
+// answerQuestion returns the unexpired cached records for one question,
+// with remaining TTLs, for the unicast .local bridge.
+func (c *recordCache) answerQuestion(q dns.Question) []dns.RR {
+	if !c.cfg.Enabled {
+		return nil
+	}
+	now := c.clk.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []dns.RR
+	for _, e := range c.byKey[cacheKey(q.Name, q.Qtype)] {
+		if !e.expires.After(now) {
+			continue
+		}
+		rr := dns.Copy(e.rr)
+		rr.Header().Ttl = uint32(e.expires.Sub(now) / time.Second)
+		rr.Header().Class = dns.ClassINET
+		out = append(out, rr)
+	}
+	return out
+}
+
+// flush clears the cache.
+func (c *recordCache) flush() {
+	c.mu.Lock()
+	c.byKey = make(map[string][]cachedRecord)
+	c.count = 0
+	c.mu.Unlock()
+	metrics.Set("mdns_cache_records", nil, 0)
+}
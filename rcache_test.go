@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// cacheResponse builds a parsed response packet carrying the given record.
+func cacheResponse(t *testing.T, rrText string) *packet {
+	t.Helper()
+	rr, err := dns.NewRR(rrText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := new(dns.Msg)
+	msg.Response = true
+	msg.Answer = []dns.RR{rr}
+	raw, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkt, err := parsePacket(raw, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2)}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkt
+}
+
+func TestRecordCacheAnswerAndExpiry(t *testing.T) {
+	clk := &fakeClock{t: time.Unix(1700000000, 0)}
+	c := newRecordCache(&RecordCacheConfig{Enabled: true})
+	c.clk = clk
+
+	c.observe(cacheResponse(t, "_ipp._tcp.local. 120 IN PTR printer._ipp._tcp.local."))
+
+	query := testQuery(t, "_ipp._tcp.local.")
+	resp := c.answer(query)
+	if resp == nil || len(resp.Answer) != 1 {
+		t.Fatalf("cached record should answer the query, got %v", resp)
+	}
+	if ttl := resp.Answer[0].Header().Ttl; ttl == 0 || ttl > 120 {
+		t.Fatalf("answer must carry the remaining TTL, got %d", ttl)
+	}
+
+	clk.advance(121 * time.Second)
+	if resp := c.answer(query); resp != nil {
+		t.Fatalf("expired record must not answer, got %v", resp)
+	}
+}
+
+func TestRecordCacheGoodbyeEvicts(t *testing.T) {
+	clk := &fakeClock{t: time.Unix(1700000000, 0)}
+	c := newRecordCache(&RecordCacheConfig{Enabled: true})
+	c.clk = clk
+
+	c.observe(cacheResponse(t, "_ipp._tcp.local. 120 IN PTR printer._ipp._tcp.local."))
+	c.observe(cacheResponse(t, "_ipp._tcp.local. 0 IN PTR printer._ipp._tcp.local."))
+
+	if resp := c.answer(testQuery(t, "_ipp._tcp.local.")); resp != nil {
+		t.Fatalf("goodbye must evict the record set, got %v", resp)
+	}
+}
@@ -0,0 +1,1188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/ipv4"
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Reflector owns the mDNS socket and applies the configured rules to every
+// packet it receives.
+type Reflector struct {
+	// cfg is the live configuration; reads go through config() so a
+	// reload can swap it atomically. cfgMu guards the swap only — a
+	// snapshot taken mid-packet stays valid because old configs are
+	// never mutated.
+	cfg   *Config
+	cfgMu sync.RWMutex
+	conn  *ipv4.PacketConn
+	uc    *net.UDPConn
+
+	// ifaceIndex maps a kernel interface index to the configured group the
+	// interface belongs to.
+	ifaceIndex map[int]*Group
+	// ifaces maps interface name to the resolved interface for sending.
+	ifaces map[string]*net.Interface
+	// ifaceStates tracks per-interface send health; see iface_state.go.
+	ifaceStates map[string]*ifaceState
+
+	mu sync.Mutex
+	// recentQueries records outstanding questions per (destination
+	// interface, question name, qtype) — see windowKey — so one chatty
+	// client cannot hold the response window open for an entire VLAN.
+	// Each entry remembers where matching responses should be sent back.
+	recentQueries map[string]*recentQuery
+	// unconfiguredSeen tracks which unconfigured interfaces were already
+	// logged about.
+	unconfiguredSeen map[int]bool
+	// budgets holds the per-group traffic budget buckets.
+	budgets map[string]*budgetState
+	// queryPrefilter holds, per group, the service patterns a query must
+	// mention to possibly match any rule; see fastpath.go. Nil when a
+	// group has a rule without service filters.
+	queryPrefilter map[string]*prefilter
+	// lastRx records when a packet was last received per interface, for
+	// diagnostics.
+	lastRx map[string]time.Time
+	// bridgeOf maps an attached interface to its Linux bridge, if any.
+	bridgeOf map[string]string
+	// socks holds one socket per VRF; key "" is the default VRF. r.uc and
+	// r.conn alias the default entry for components that never touch a
+	// VRF.
+	socks map[string]*vrfSocket
+
+	queryWindow time.Duration
+	started     time.Time
+	// clk is swapped for a fake in deterministic tests.
+	clk clock
+	// cfgPath is the file the config was loaded from, for reloads.
+	cfgPath string
+
+	health    *healthChecker
+	slo       *sloTracker
+	dedup     *dedupTable
+	retrier   *retrier
+	history   *historyRing
+	companion *companionAssist
+	corpus    *corpusRecorder
+	events    *eventBus
+	inv       *inventory
+	suggest   *suggestTracker
+	shadow    *shadowState
+	fanout    *fanoutGuard
+	conform   *conformanceMonitor
+	svcStats  *serviceStats
+	mirrors   *mirrorSet
+	responder *responder
+	rcache    *recordCache
+	anomaly   *anomalyDetector
+	goodbyes  *goodbyeGuard
+	ownership *ownershipTable
+	poison    *poisonGuard
+	learning  *learningState
+	peers     *peerSet
+	capture   *captureBus
+	rlimit    *rateLimitSet
+	pdedup    *payloadDedup
+	closing   atomic.Bool
+	listenWG  sync.WaitGroup
+
+	// paused halts forwarding while leaving listeners and state alive;
+	// see pause.go.
+	paused atomic.Bool
+	bridge *unicastBridge
+}
+
+// recentQuery tracks an open response window on one interface.
+type recentQuery struct {
+	when    time.Time
+	replyTo []string     // interface names to reflect responses back onto
+	querier *net.UDPAddr // source of the query, for unicast conversion
+	id      uint16       // the query's ID, echoed in legacy unicast replies
+	quRelay bool         // relay the response to the querier by unicast (qu_policy)
+	scrub   *ScrubConfig // scrub relayed responses per the opening rule
+}
+
+// windowHit is what matching a response against an open window yields
+// besides the reply interfaces.
+type windowHit struct {
+	querier *net.UDPAddr
+	id      uint16
+	quRelay bool
+	scrub   *ScrubConfig
+}
+
+// config returns the live configuration snapshot.
+func (r *Reflector) config() *Config {
+	r.cfgMu.RLock()
+	defer r.cfgMu.RUnlock()
+	return r.cfg
+}
+
+// NewReflector resolves the configured interfaces and prepares the
+// reflector; the socket is not opened until Start.
+func NewReflector(cfg *Config) (*Reflector, error) {
+	r := &Reflector{
+		cfg:              cfg,
+		ifaceIndex:       make(map[int]*Group),
+		ifaces:           make(map[string]*net.Interface),
+		ifaceStates:      make(map[string]*ifaceState),
+		recentQueries:    make(map[string]*recentQuery),
+		unconfiguredSeen: make(map[int]bool),
+		budgets:          make(map[string]*budgetState),
+		queryPrefilter:   make(map[string]*prefilter),
+		lastRx:           make(map[string]time.Time),
+		bridgeOf:         make(map[string]string),
+		socks:            make(map[string]*vrfSocket),
+		queryWindow:      time.Duration(cfg.QueryWindow) * time.Second,
+		started:          time.Now(),
+		clk:              realClock{},
+	}
+	r.queryPrefilter = buildPrefilters(cfg)
+	r.slo = newSLOTracker(r.queryWindow)
+	r.events = newEventBus()
+	r.inv = newInventory()
+	r.inv.events = r.events
+	r.suggest = newSuggestTracker()
+	r.dedup = newDedupTable(&cfg.QueryDedup)
+	r.dedup.clk = r.clk
+	r.retrier = newRetrier(r)
+	r.history = newHistoryRing(&cfg.History)
+	r.companion = newCompanionAssist()
+	r.corpus = newCorpusRecorder(&cfg.Corpus)
+	r.shadow = &shadowState{}
+	r.fanout = newFanoutGuard(r)
+	r.conform = newConformanceMonitor()
+	r.svcStats = newServiceStats()
+	r.mirrors = openMirrors(cfg)
+	r.responder = newResponder(r, &cfg.Responder)
+	r.rcache = newRecordCache(&cfg.RecordCache)
+	r.rcache.clk = r.clk
+	r.anomaly = newAnomalyDetector(r)
+	r.goodbyes = newGoodbyeGuard(r)
+	r.ownership = newOwnershipTable(r)
+	r.poison = newPoisonGuard(r)
+	r.learning = newLearningState(r)
+	r.peers = newPeerSet(r)
+	r.capture = newCaptureBus()
+	r.rlimit = newRateLimitSet(r)
+	r.pdedup = newPayloadDedup(&cfg.PayloadDedup)
+	r.pdedup.clk = r.clk
+	for gi := range cfg.Groups {
+		g := &cfg.Groups[gi]
+		for _, name := range g.Interfaces {
+			ifi, err := net.InterfaceByName(name)
+			if err != nil {
+				if cfg.Hotplug {
+					// The hotplug watcher joins it when it appears.
+					log.Printf("group %q: interface %s absent, waiting for hotplug", g.Name, name)
+					continue
+				}
+				return nil, fmt.Errorf("group %q: interface %s: %w", g.Name, name, err)
+			}
+			if other, ok := r.ifaceIndex[ifi.Index]; ok {
+				// Sharing a physical interface is only meaningful when the
+				// extra group is distinguished by source subnet.
+				if len(g.subnets) == 0 && len(other.subnets) == 0 {
+					return nil, fmt.Errorf("interface %s is in both group %q and group %q", name, other.Name, g.Name)
+				}
+			} else {
+				r.ifaceIndex[ifi.Index] = g
+			}
+			r.ifaces[name] = ifi
+		}
+	}
+	r.buildBridgeMap()
+	return r, nil
+}
+
+// Start opens the mDNS socket, joins the multicast group on every
+// configured interface and launches the listen loop.
+func (r *Reflector) Start() error {
+	for _, vrf := range r.vrfNames() {
+		if err := r.openSocket(vrf); err != nil {
+			return err
+		}
+		r.listenWG.Add(1)
+		go r.listen(vrf)
+	}
+	go r.retrier.run()
+	go r.fanout.run()
+	go r.responder.announce()
+	return nil
+}
+
+// vrfNames returns the default VRF ("") plus every distinct vrf
+// configured on a group.
+func (r *Reflector) vrfNames() []string {
+	out := []string{""}
+	seen := map[string]bool{"": true}
+	cfg := r.config()
+	for i := range cfg.Groups {
+		if v := cfg.Groups[i].Vrf; v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// vrfOf returns the VRF an interface's group is bound to, or "".
+func (r *Reflector) vrfOf(ifaceName string) string {
+	if g := r.groupOfIface(ifaceName); g != nil {
+		return g.Vrf
+	}
+	return ""
+}
+
+// sock returns the socket serving a VRF.
+func (r *Reflector) sock(vrf string) *vrfSocket {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.socks[vrf]
+}
+
+// connFor returns the packet connection an interface must be written to:
+// its VRF's socket, or the default one.
+func (r *Reflector) connFor(ifaceName string) *ipv4.PacketConn {
+	if vs := r.sock(r.vrfOf(ifaceName)); vs != nil {
+		return vs.conn
+	}
+	return r.conn
+}
+
+// vrfSocket is one mDNS socket, bound into a VRF when vrf is non-empty.
+type vrfSocket struct {
+	vrf  string
+	uc   *net.UDPConn
+	conn *ipv4.PacketConn
+}
+
+// openSocket (re)creates the mDNS socket for one VRF and joins the
+// multicast group on every interface whose group lives in that VRF. A
+// VRF-bound socket needs SO_BINDTODEVICE on the VRF device to receive and
+// send inside it.
+func (r *Reflector) openSocket(vrf string) error {
+	// A socket inherited from the previous process (fd store handoff)
+	// already carries its VRF binding and group memberships.
+	inherited := false
+	uc := sys.InheritedConn(fdName(vrf))
+	if uc != nil {
+		inherited = true
+		log.Printf("adopted inherited socket for vrf %q", vrf)
+	} else {
+		var err error
+		uc, err = net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: mdnsGroup.Port})
+		if err != nil {
+			return err
+		}
+		if vrf != "" {
+			if err := sys.BindToDevice(uc, vrf); err != nil {
+				uc.Close()
+				return fmt.Errorf("binding socket to vrf %s: %w", vrf, err)
+			}
+		}
+	}
+	conn := ipv4.NewPacketConn(uc)
+	if err := conn.SetControlMessage(ipv4.FlagInterface|ipv4.FlagTTL|ipv4.FlagDst, true); err != nil {
+		uc.Close()
+		return err
+	}
+	if err := conn.SetMulticastTTL(255); err != nil {
+		uc.Close()
+		return err
+	}
+	if err := conn.SetMulticastLoopback(false); err != nil {
+		uc.Close()
+		return err
+	}
+	for name, ifi := range r.ifaces {
+		if r.vrfOf(name) != vrf {
+			continue
+		}
+		if err := conn.JoinGroup(ifi, mdnsGroup); err != nil {
+			if inherited {
+				// Memberships survive the handoff; re-joining fails
+				// with EADDRINUSE and that is fine.
+				continue
+			}
+			uc.Close()
+			return fmt.Errorf("joining %s on %s: %w", mdnsGroup.IP, name, err)
+		}
+	}
+	if err := sys.EnableRxTimestamps(uc); err != nil {
+		log.Printf("kernel receive timestamps unavailable: %v", err)
+	}
+	r.mu.Lock()
+	r.socks[vrf] = &vrfSocket{vrf: vrf, uc: uc, conn: conn}
+	r.mu.Unlock()
+	if vrf == "" {
+		r.conn = conn
+		r.uc = uc
+	}
+	return nil
+}
+
+// socketRebuildAttempts bounds how often a broken socket is rebuilt before
+// the daemon gives up and exits, so a persistent failure is visible to the
+// process supervisor rather than leaving a silent zombie.
+const socketRebuildAttempts = 10
+
+// listen is the receive loop: one packet in, zero or more packets out.
+// Transient read errors are skipped; a persistent error tears the socket
+// down and rebuilds it (rejoining all groups), which recovers from
+// suspend/resume cycles and address changes.
+func (r *Reflector) listen(vrf string) {
+	defer r.listenWG.Done()
+	oob := make([]byte, 512)
+	for {
+		bp := getBuf()
+		n, oobn, _, src, err := r.sock(vrf).uc.ReadMsgUDP(*bp, oob)
+		if err != nil {
+			putBuf(bp)
+			if r.closing.Load() {
+				return
+			}
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				continue
+			}
+			r.reportError(errSocket, "reading from mDNS socket, rebuilding", err)
+			if !r.rebuildSocket(vrf) {
+				log.Fatalf("giving up after %d socket rebuild attempts", socketRebuildAttempts)
+			}
+			continue
+		}
+		meta := sys.ParseOOB(oob[:oobn])
+		ifindex := meta.ifindex
+		if ifindex == 0 {
+			putBuf(bp)
+			continue
+		}
+		r.conform.observe((*bp)[:n], src, meta, r.ifaceName(ifindex))
+		start := time.Now()
+		if !meta.kstamp.IsZero() {
+			if sojourn := start.Sub(meta.kstamp); sojourn >= 0 {
+				if name := r.ifaceName(ifindex); name != "" {
+					metrics.Observe("mdns_rx_sojourn_seconds", Labels{"iface": name}, sojourn.Seconds())
+				}
+			} else {
+				// A receive timestamp in the future means the clocks used
+				// by the kernel and the runtime disagree; surface it.
+				metrics.Set("mdns_clock_skew_seconds", nil, sojourn.Seconds())
+			}
+		}
+		r.handlePacket((*bp)[:n], src, ifindex)
+		putBuf(bp)
+		metrics.Observe("mdns_processing_seconds", nil, time.Since(start).Seconds())
+	}
+}
+
+// rebuildSocket closes and reopens the mDNS socket with exponential
+// backoff, reporting whether it eventually succeeded.
+func (r *Reflector) rebuildSocket(vrf string) bool {
+	r.sock(vrf).conn.Close()
+	backoff := time.Second
+	for attempt := 1; attempt <= socketRebuildAttempts; attempt++ {
+		if err := r.openSocket(vrf); err != nil {
+			log.Printf("socket rebuild attempt %d/%d: %v", attempt, socketRebuildAttempts, err)
+			time.Sleep(backoff)
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+			continue
+		}
+		metrics.Inc("mdns_socket_rebuilds_total", nil)
+		log.Printf("socket rebuilt, multicast groups rejoined")
+		return true
+	}
+	return false
+}
+
+// handlePacket parses one received datagram and applies the rule table.
+func (r *Reflector) handlePacket(payload []byte, src *net.UDPAddr, ifindex int) {
+	group := r.classify(src.IP, ifindex)
+	if group == nil {
+		group = r.handleUnconfigured(src, ifindex)
+		if group == nil {
+			return
+		}
+	}
+	if r.prefilterDrops(payload, group) {
+		return
+	}
+	if r.pdedup.drop(payload, r.ifaceName(ifindex)) {
+		metrics.Inc("mdns_dropped_total", Labels{"reason": "loop"})
+		return
+	}
+	pkt, err := parsePacket(payload, src, ifindex)
+	if err != nil {
+		if msg, ok := parseLax(payload); ok && r.config().LaxDecode {
+			pkt = &packet{payload: payload, msg: msg, src: src, ifindex: ifindex, lax: true}
+			metrics.Inc("mdns_lax_decoded_total", nil)
+			if r.config().Debug {
+				log.Printf("lax-decoded packet from %s: %s", src.IP, getMsgSummary(msg))
+			}
+		} else {
+			r.reportError(errParse, fmt.Sprintf("dropping unparseable packet from %s", src.IP), err)
+			return
+		}
+	}
+	if !pkt.classesSane() {
+		metrics.Inc("mdns_dropped_total", Labels{"reason": "bad-class"})
+		if r.config().Debug {
+			log.Printf("dropping packet from %s: non-IN class", src.IP)
+		}
+		return
+	}
+	r.fanout.observeIn()
+	srcIface := r.ifaceName(ifindex)
+	if r.capture.active() {
+		r.tapPacket(pkt, srcIface)
+	}
+	if r.anomaly.blocked(src.IP) {
+		metrics.Inc("mdns_quarantine_dropped_total", Labels{"iface": srcIface})
+		return
+	}
+	r.anomaly.observe(pkt, srcIface)
+	if pkt.class() == "goodbye" {
+		if !r.goodbyes.allow(pkt, srcIface) {
+			return
+		}
+	} else {
+		r.goodbyes.observe(pkt)
+	}
+	if !r.ownership.check(pkt, srcIface) {
+		return
+	}
+	if !r.poison.check(pkt, srcIface) {
+		return
+	}
+	if srcIface != "" {
+		r.mu.Lock()
+		r.lastRx[srcIface] = time.Now()
+		r.mu.Unlock()
+	}
+
+	if r.health != nil {
+		r.health.observe(pkt)
+	}
+	r.inv.observe(pkt, srcIface)
+	r.history.observe(pkt, srcIface)
+	r.corpus.record(pkt)
+	r.suggest.observe(group.Name, pkt)
+	r.svcStats.observe(group.Name, pkt)
+	r.responder.answer(pkt, srcIface, group)
+	r.rcache.observe(pkt)
+	localHosts.observeHosts(pkt)
+	if r.bridge != nil {
+		r.bridge.observe(pkt)
+	}
+	r.shadow.compare(r.config(), pkt, srcIface)
+
+	if !r.validateAnswerSource(pkt, srcIface) {
+		log.Printf("dropping response from %s: answer-source validation failed", src.IP)
+		return
+	}
+
+	if r.dedup.duplicate(pkt, srcIface) {
+		metrics.Inc("mdns_dedup_suppressed_total", Labels{"iface": srcIface})
+		return
+	}
+
+	// A query the cache can fully answer is answered on its own VLAN and
+	// never wakes the device VLANs.
+	if resp := r.rcache.answer(pkt); resp != nil {
+		if r.legacyQuerier(pkt.src) {
+			r.sendLegacy(resp, pkt.msg.Id, srcIface, pkt.src, "cache")
+			r.publishDecision(pkt, srcIface, "cache-answered", "", nil)
+			return
+		}
+		if wire, err := resp.Pack(); err == nil {
+			r.send(wire, srcIface)
+			metrics.Inc("mdns_cache_answers_total", Labels{"iface": srcIface})
+			r.publishDecision(pkt, srcIface, "cache-answered", "", nil)
+			return
+		}
+	}
+
+	// Follow-up queries referenced by a just-reflected AirPlay response
+	// go straight back to the responder's interface; see companion.go.
+	if dst := r.companion.match(pkt); dst != "" && dst != srcIface {
+		dsts := []string{dst}
+		r.openWindow(dsts, srcIface, pkt.src, pkt)
+		r.forward(pkt, srcIface, dsts, "companion")
+		return
+	}
+
+	// Client overrides beat the rule table.
+	ovr := r.config().clientOverride(src.IP)
+	if ovr != nil && ovr.Policy == "deny" {
+		metrics.Inc("mdns_client_override_total", Labels{"policy": "deny"})
+		r.publishDecision(pkt, srcIface, "dropped", "client override", nil)
+		return
+	}
+
+	// During the learning period everything crosses every boundary and
+	// the rule table is ignored; what actually traveled feeds /learning.
+	if r.learning.active() {
+		dsts, toGroups := r.learningDestinations(group, srcIface)
+		if len(dsts) > 0 {
+			r.learning.observe(group.Name, toGroups, pkt)
+			if !pkt.msg.Response {
+				r.openWindow(dsts, srcIface, pkt.src, pkt)
+				r.slo.querySent(pkt.services())
+			}
+			r.forwardLogged(pkt, srcIface, dsts, "learning", "")
+		}
+		return
+	}
+
+	if pkt.msg.Response {
+		// A response within the window of a reflected query goes back the
+		// way the query came — but only when its answers match a question
+		// actually outstanding on this interface, so unsolicited traffic
+		// cannot ride another client's window.
+		replyTo, hit := r.matchWindow(pkt, srcIface)
+		open := len(replyTo) > 0
+		pkt.solicited = open
+		if open {
+			for _, origin := range replyTo {
+				r.retrier.satisfied(origin)
+			}
+			r.forwardResponse(pkt, srcIface, replyTo, hit)
+			r.companion.observeResponse(pkt, srcIface)
+			r.slo.responseSeen(pkt.services())
+		}
+	}
+
+	if ovr != nil {
+		dsts := r.overrideDestinations(ovr, group, srcIface)
+		if len(dsts) > 0 {
+			if !pkt.msg.Response {
+				r.openWindow(dsts, srcIface, pkt.src, pkt)
+				r.slo.querySent(pkt.services())
+			}
+			r.forward(pkt, srcIface, dsts, "client override")
+			metrics.Inc("mdns_client_override_total", Labels{"policy": "allow"})
+		}
+		return
+	}
+
+	cfg := r.config()
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.From != group.Name {
+			continue
+		}
+		if !rule.Filter.match(pkt) {
+			continue
+		}
+		if !r.rlimit.allow(&rule.RateLimit, rule.label(i), pkt.src.IP.String()) {
+			continue
+		}
+		if rule.Mirror != "" {
+			r.mirrors.copyTo(rule.Mirror, pkt)
+		}
+		dsts := r.ruleDestinations(rule, srcIface)
+		dsts = r.fanout.cap(dsts, rule.MaxFanout, rule.label(i))
+		if len(dsts) == 0 {
+			continue
+		}
+		fwd := pkt
+		if pkt.msg.Response && rule.Scrub.active() {
+			if fwd = rule.Scrub.scrubPacket(pkt, rule.label(i)); fwd == nil {
+				continue
+			}
+		}
+		if d := rule.delay(); d > 0 && fwd.msg.Response {
+			r.forwardAfter(d, fwd, srcIface, dsts, rule.label(i), rule.Log)
+			continue
+		}
+		for _, out := range rule.shapeQuestions(fwd) {
+			if !out.msg.Response {
+				if rule.Scrub.active() {
+					// Copy so the scrub rides only this rule's window.
+					cp := *out
+					cp.scrub = &rule.Scrub
+					out = &cp
+				}
+				if rule.QUPolicy == "preserve" || rule.QUPolicy == "answer-unicast" {
+					// Copy: other rules may still strip the bit.
+					cp := *out
+					cp.keepQU = true
+					cp.quRelay = rule.QUPolicy == "answer-unicast"
+					out = &cp
+				}
+				r.openWindow(dsts, srcIface, out.src, out)
+				r.slo.querySent(out.services())
+			}
+			r.forwardLogged(out, srcIface, dsts, rule.label(i), rule.Log)
+		}
+	}
+}
+
+// handleUnconfigured applies the unconfigured_interfaces policy to a packet
+// from an interface outside every group. It returns the fallback group to
+// process the packet under, or nil to drop it. Logging happens once per
+// interface so a misconfigured name is visible without flooding.
+func (r *Reflector) handleUnconfigured(src *net.UDPAddr, ifindex int) *Group {
+	cfg := r.config().Unconfigured
+	if cfg.Action == "" || cfg.Action == "ignore" {
+		if cfg.Group == "" {
+			return nil
+		}
+	}
+	name := fmt.Sprintf("ifindex-%d", ifindex)
+	if ifi, err := net.InterfaceByIndex(ifindex); err == nil {
+		name = ifi.Name
+	}
+	metrics.Inc("mdns_unconfigured_packets_total", Labels{"iface": name})
+	if cfg.Action == "log" {
+		r.mu.Lock()
+		logged := r.unconfiguredSeen[ifindex]
+		r.unconfiguredSeen[ifindex] = true
+		r.mu.Unlock()
+		if !logged {
+			log.Printf("packets arriving on unconfigured interface %s (first from %s); check group interface names", name, src.IP)
+		}
+	}
+	if cfg.Group != "" {
+		return r.config().group(cfg.Group)
+	}
+	return nil
+}
+
+// windowState is one open (or expired) response window, for the state
+// snapshot.
+type windowState struct {
+	Iface    string    `json:"iface"`
+	Question string    `json:"question,omitempty"`
+	Since    time.Time `json:"since"`
+	Open     bool      `json:"open"`
+	ReplyTo  []string  `json:"reply_to"`
+}
+
+// reflectorState is a point-in-time snapshot of the stateful tables,
+// exposed for tests and the admin API.
+type reflectorState struct {
+	Windows      []windowState `json:"windows"`
+	DedupEntries int           `json:"dedup_entries"`
+	Degraded     []string      `json:"degraded_ifaces,omitempty"`
+}
+
+// stateSnapshot assembles the current stateful-table contents.
+func (r *Reflector) stateSnapshot() reflectorState {
+	now := r.clk.Now()
+	var st reflectorState
+	r.mu.Lock()
+	for key, rq := range r.recentQueries {
+		parts := strings.SplitN(key, "\x00", 3)
+		w := windowState{
+			Iface:   parts[0],
+			Since:   rq.when,
+			Open:    now.Sub(rq.when) < r.queryWindow,
+			ReplyTo: rq.replyTo,
+		}
+		if len(parts) > 1 {
+			w.Question = parts[1]
+		}
+		st.Windows = append(st.Windows, w)
+	}
+	for name, ifs := range r.ifaceStates {
+		ifs.mu.Lock()
+		if ifs.degraded {
+			st.Degraded = append(st.Degraded, name)
+		}
+		ifs.mu.Unlock()
+	}
+	r.mu.Unlock()
+	r.dedup.mu.Lock()
+	st.DedupEntries = len(r.dedup.seen)
+	r.dedup.mu.Unlock()
+	sort.Slice(st.Windows, func(i, j int) bool { return st.Windows[i].Iface < st.Windows[j].Iface })
+	return st
+}
+
+// flushQueries drops all open query windows and pending unicast
+// questions.
+func (r *Reflector) flushQueries() {
+	r.mu.Lock()
+	r.recentQueries = make(map[string]*recentQuery)
+	r.mu.Unlock()
+	if r.bridge != nil {
+		r.bridge.flush()
+	}
+}
+
+// classify resolves the policy group for a packet. Subnet-defined groups
+// take precedence over the interface's own group, so overlay subnets on a
+// shared interface get their own policy.
+func (r *Reflector) classify(srcIP net.IP, ifindex int) *Group {
+	cfg := r.config()
+	for i := range cfg.Groups {
+		g := &cfg.Groups[i]
+		if len(g.subnets) > 0 && g.containsIP(srcIP) {
+			return g
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ifaceIndex[ifindex]
+}
+
+// ruleDestinations lists the interfaces a rule fans out to, excluding the
+// interface the packet arrived on. Group membership can change at runtime
+// via the attach/detach API, hence the locking.
+func (r *Reflector) ruleDestinations(rule *Rule, srcIface string) []string {
+	var dsts []string
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, to := range rule.To {
+		if to == rule.From && !rule.ReflectWithinSourceGroup {
+			// Reflecting onto the source's own group amplifies within the
+			// segment; it takes an explicit opt-in.
+			continue
+		}
+		if r.config().peer(to) != nil {
+			dsts = append(dsts, "peer:"+to)
+			continue
+		}
+		dsts = append(dsts, r.groupTargets(r.config().group(to), srcIface)...)
+	}
+	return dsts
+}
+
+// groupTargets expands a destination group to interface names honoring its
+// send_policy; the caller holds r.mu.
+func (r *Reflector) groupTargets(g *Group, srcIface string) []string {
+	var out []string
+	for _, name := range g.Interfaces {
+		if name == srcIface {
+			continue
+		}
+		if g.SendPolicy == "primary" {
+			// First healthy member wins; a degraded primary fails over
+			// to the next.
+			healthy := true
+			if st := r.ifaceStates[name]; st != nil {
+				st.mu.Lock()
+				healthy = !st.degraded
+				st.mu.Unlock()
+			}
+			if healthy {
+				return []string{name}
+			}
+			out = append(out, name)
+			continue
+		}
+		out = append(out, name)
+	}
+	if g.SendPolicy == "primary" && len(out) > 1 {
+		// Every member is degraded: still send on one, not all.
+		out = out[:1]
+	}
+	return out
+}
+
+// AttachInterface joins the multicast group on a new interface and adds it
+// to the named policy group at runtime.
+func (r *Reflector) AttachInterface(groupName, ifaceName string) error {
+	g := r.config().group(groupName)
+	if g == nil {
+		return fmt.Errorf("unknown group %q", groupName)
+	}
+	ifi, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return fmt.Errorf("interface %s: %w", ifaceName, err)
+	}
+	r.mu.Lock()
+	if _, ok := r.ifaces[ifaceName]; ok {
+		r.mu.Unlock()
+		return fmt.Errorf("interface %s is already attached", ifaceName)
+	}
+	r.ifaces[ifaceName] = ifi
+	r.ifaceIndex[ifi.Index] = g
+	g.Interfaces = append(g.Interfaces, ifaceName)
+	r.buildBridgeMap()
+	r.mu.Unlock()
+	if err := r.connFor(ifaceName).JoinGroup(ifi, mdnsGroup); err != nil {
+		r.detach(ifaceName, false)
+		return fmt.Errorf("joining %s on %s: %w", mdnsGroup.IP, ifaceName, err)
+	}
+	log.Printf("attached interface %s to group %q", ifaceName, groupName)
+	return nil
+}
+
+// DetachInterface removes an interface from its group and leaves the
+// multicast group on it.
+func (r *Reflector) DetachInterface(ifaceName string) error {
+	return r.detach(ifaceName, true)
+}
+
+func (r *Reflector) detach(ifaceName string, leave bool) error {
+	r.mu.Lock()
+	ifi, ok := r.ifaces[ifaceName]
+	if !ok {
+		r.mu.Unlock()
+		return fmt.Errorf("interface %s is not attached", ifaceName)
+	}
+	delete(r.ifaces, ifaceName)
+	delete(r.ifaceIndex, ifi.Index)
+	cfg := r.config()
+	for gi := range cfg.Groups {
+		g := &cfg.Groups[gi]
+		for i, name := range g.Interfaces {
+			if name == ifaceName {
+				g.Interfaces = append(g.Interfaces[:i], g.Interfaces[i+1:]...)
+				break
+			}
+		}
+	}
+	r.mu.Unlock()
+	if leave {
+		if err := r.connFor(ifaceName).LeaveGroup(ifi, mdnsGroup); err != nil {
+			log.Printf("leaving %s on %s: %v", mdnsGroup.IP, ifaceName, err)
+		}
+		log.Printf("detached interface %s", ifaceName)
+	}
+	return nil
+}
+
+// overrideDestinations resolves where an allow-override forwards to: the
+// override's explicit groups, or the union of destinations of every rule
+// matching the client's group with filters bypassed.
+func (r *Reflector) overrideDestinations(ovr *ClientOverride, group *Group, srcIface string) []string {
+	seen := make(map[string]bool)
+	var dsts []string
+	add := func(names []string) {
+		for _, n := range names {
+			if !seen[n] {
+				seen[n] = true
+				dsts = append(dsts, n)
+			}
+		}
+	}
+	if len(ovr.To) > 0 {
+		for _, to := range ovr.To {
+			add(r.ruleDestinations(&Rule{To: []string{to}}, srcIface))
+		}
+		return dsts
+	}
+	cfg := r.config()
+	for i := range cfg.Rules {
+		if cfg.Rules[i].From == group.Name {
+			add(r.ruleDestinations(&cfg.Rules[i], srcIface))
+		}
+	}
+	return dsts
+}
+
+// windowKey identifies one outstanding question on one destination
+// interface.
+func windowKey(iface, name string, qtype uint16) string {
+	return iface + "\x00" + strings.ToLower(name) + "\x00" + strconv.Itoa(int(qtype))
+}
+
+// windowSweepSize bounds the window table; beyond it expired entries are
+// collected on the next openWindow.
+const windowSweepSize = 4096
+
+// openWindow records each of the packet's questions as outstanding on
+// every destination interface, expecting responses to be reflected back
+// onto the query's source interface. The querier address is kept for
+// Wi-Fi unicast conversion.
+func (r *Reflector) openWindow(dsts []string, srcIface string, querier *net.UDPAddr, pkt *packet) {
+	now := r.clk.Now()
+	r.mu.Lock()
+	if len(r.recentQueries) > windowSweepSize {
+		for key, rq := range r.recentQueries {
+			if now.Sub(rq.when) >= r.queryWindow {
+				delete(r.recentQueries, key)
+			}
+		}
+	}
+	for _, d := range dsts {
+		for _, q := range pkt.msg.Question {
+			key := windowKey(d, q.Name, q.Qtype)
+			rq := r.recentQueries[key]
+			if rq == nil {
+				rq = &recentQuery{}
+				r.recentQueries[key] = rq
+			} else if now.Sub(rq.when) >= r.queryWindow {
+				// The previous window expired; its claims are stale.
+				rq.replyTo = nil
+			}
+			rq.when = now
+			// Queriers on several interfaces can share one window; each
+			// keeps its claim on the response.
+			claimed := false
+			for _, o := range rq.replyTo {
+				if o == srcIface {
+					claimed = true
+					break
+				}
+			}
+			if !claimed {
+				rq.replyTo = append(rq.replyTo, srcIface)
+			}
+			rq.querier = querier
+			rq.id = pkt.msg.Id
+			rq.quRelay = pkt.quRelay
+			rq.scrub = pkt.scrub
+		}
+	}
+	r.mu.Unlock()
+}
+
+// matchWindow returns where a response should be reflected back to, by
+// matching its answer records against the questions outstanding on the
+// interface it arrived on.
+func (r *Reflector) matchWindow(pkt *packet, srcIface string) ([]string, windowHit) {
+	records := pkt.msg.Answer
+	if len(records) == 0 {
+		records = pkt.msg.Extra
+	}
+	now := r.clk.Now()
+	var replyTo []string
+	var hit windowHit
+	seen := make(map[string]bool)
+	r.mu.Lock()
+	for _, rr := range records {
+		hdr := rr.Header()
+		for _, key := range []string{
+			windowKey(srcIface, hdr.Name, hdr.Rrtype),
+			windowKey(srcIface, hdr.Name, dns.TypeANY),
+		} {
+			rq := r.recentQueries[key]
+			if rq == nil || now.Sub(rq.when) >= r.queryWindow {
+				continue
+			}
+			for _, o := range rq.replyTo {
+				if !seen[o] {
+					seen[o] = true
+					replyTo = append(replyTo, o)
+				}
+			}
+			hit.querier = rq.querier
+			hit.id = rq.id
+			hit.quRelay = hit.quRelay || rq.quRelay
+			if hit.scrub == nil {
+				hit.scrub = rq.scrub
+			}
+		}
+	}
+	r.mu.Unlock()
+	return replyTo, hit
+}
+
+// forwardResponse reflects a response back towards the querier. For
+// destinations in Wi-Fi-marked groups the response is unicast directly to
+// the original querier instead of multicast, saving wireless airtime.
+func (r *Reflector) forwardResponse(pkt *packet, srcIface string, dsts []string, hit windowHit) {
+	if r.pauseDrops() {
+		return
+	}
+	if hit.scrub != nil {
+		if pkt = hit.scrub.scrubPacket(pkt, "window"); pkt == nil {
+			return
+		}
+	}
+	if r.legacyQuerier(hit.querier) {
+		// A legacy client never hears multicast: the reply goes straight
+		// back to its source port, RFC 6762 §6.7 style.
+		for _, name := range dsts {
+			r.sendLegacy(pkt.msg, hit.id, name, hit.querier, "relay")
+		}
+		return
+	}
+	var multicast []string
+	for _, name := range dsts {
+		g := r.groupOfIface(name)
+		if g != nil && (g.Wifi || hit.quRelay) && hit.querier != nil {
+			r.sendUnicast(pkt, name, hit.querier)
+			continue
+		}
+		multicast = append(multicast, name)
+	}
+	if len(multicast) > 0 {
+		r.forward(pkt, srcIface, multicast, "response window")
+	}
+}
+
+// sendUnicast delivers a reflected response straight to the querier.
+func (r *Reflector) sendUnicast(pkt *packet, ifaceName string, dst *net.UDPAddr) {
+	wire, err := pkt.wire()
+	if err != nil {
+		r.reportError(errParse, fmt.Sprintf("repacking packet from %s", pkt.src.IP), err)
+		return
+	}
+	ifi := r.iface(ifaceName)
+	if ifi == nil {
+		return
+	}
+	if r.config().ObserveOnly {
+		r.publishDecision(pkt, ifaceName, "would-unicast", "wifi", []string{ifaceName})
+		return
+	}
+	if !r.budgetAllows(ifaceName, len(wire), false) {
+		return
+	}
+	cm := &ipv4.ControlMessage{IfIndex: ifi.Index}
+	if _, err := r.connFor(ifaceName).WriteTo(wire, cm, dst); err != nil {
+		r.reportError(errForward, fmt.Sprintf("unicasting to %s via %s", dst.IP, ifaceName), err)
+		r.noteSendError(ifaceName, err)
+		return
+	}
+	r.noteSendOK(ifaceName)
+	metrics.Inc("mdns_unicast_conversions_total", Labels{"iface": ifaceName})
+	if r.config().Debug {
+		log.Printf("unicast %s to %s via %s (wifi group)", getMsgSummary(pkt.msg), dst.IP, ifaceName)
+	}
+}
+
+// forward writes the packet onto every destination interface.
+func (r *Reflector) forward(pkt *packet, srcIface string, dsts []string, why string) {
+	r.forwardLogged(pkt, srcIface, dsts, why, "")
+}
+
+// forwardLogged is forward with a per-rule log override; see Rule.Log.
+func (r *Reflector) forwardLogged(pkt *packet, srcIface string, dsts []string, why, logMode string) {
+	if r.pauseDrops() {
+		return
+	}
+	if r.config().ObserveOnly {
+		metrics.Inc("mdns_observed_total", Labels{"rule": why, "iface": srcIface})
+		r.publishDecision(pkt, srcIface, "would-reflect", why, dsts)
+		return
+	}
+	wire, err := pkt.wire()
+	if err != nil {
+		r.reportError(errParse, fmt.Sprintf("repacking packet from %s", pkt.src.IP), err)
+		return
+	}
+	familyCache := make(map[string][]byte)
+	dsts = r.dedupByBridge(dsts)
+	dsts = r.fanout.cap(dsts, 0, why)
+	now := r.clk.Now()
+	for _, name := range dsts {
+		if peer, ok := strings.CutPrefix(name, "peer:"); ok {
+			r.peers.send(peer, wire)
+			continue
+		}
+		ifi := r.iface(name)
+		if ifi == nil {
+			continue
+		}
+		dstGroup := r.groupOfIface(name)
+		if r.quietSuppresses(pkt, dstGroup, now) {
+			continue
+		}
+		out := r.familyWire(pkt, wire, dstGroup, familyCache)
+		if pkt.msg.Response && ifi.MTU > 0 && len(out) > ifi.MTU-28 {
+			r.sendSplit(out, name, ifi, ifi.MTU)
+			continue
+		}
+		if !r.budgetAllows(name, len(out), !pkt.msg.Response) {
+			continue
+		}
+		cm := &ipv4.ControlMessage{IfIndex: ifi.Index}
+		if _, err := r.connFor(name).WriteTo(out, cm, mdnsGroup); err != nil {
+			r.reportError(errForward, "forwarding to "+name, err)
+			r.noteSendError(name, err)
+		} else {
+			r.noteSendOK(name)
+			r.pdedup.note(out, name)
+		}
+	}
+	// Building the human-readable summary costs measurable CPU under
+	// load, so it only happens when something will actually emit it.
+	if (r.config().Debug && logMode != "none") || logMode == "all" {
+		mode := r.config().Privacy.Logs
+		log.Printf("reflected %s from %s (%s) to %v [%s]",
+			scrubText(getMsgSummary(pkt.msg), mode), scrubIP(pkt.src.IP.String(), mode), srcIface, dsts, why)
+	}
+	metrics.Inc("mdns_reflected_total", Labels{"rule": why, "iface": srcIface})
+	r.retrier.track(pkt, srcIface, dsts, wire)
+	r.publishDecision(pkt, srcIface, "reflected", why, dsts)
+}
+
+// forwardAfter reflects a response after a delay. The payload is copied
+// first: the original slice goes back to the buffer pool as soon as
+// handlePacket returns.
+func (r *Reflector) forwardAfter(d time.Duration, pkt *packet, srcIface string, dsts []string, why, logMode string) {
+	delayed := *pkt
+	delayed.payload = append([]byte(nil), pkt.payload...)
+	time.AfterFunc(d, func() {
+		r.forwardLogged(&delayed, srcIface, dsts, why, logMode)
+	})
+}
+
+// publishDecision emits a decision event for live subscribers of /events.
+func (r *Reflector) publishDecision(pkt *packet, srcIface, action, rule string, dsts []string) {
+	if !r.events.hasSubscribers() {
+		return
+	}
+	r.events.publish(Event{
+		Type:    "decision",
+		Iface:   srcIface,
+		SrcIP:   pkt.src.IP.String(),
+		Device:  deviceNames.lookup(lookupMAC(pkt.src.IP)),
+		Rule:    rule,
+		Action:  action,
+		Summary: getMsgSummary(pkt.msg),
+		Dsts:    dsts,
+	})
+}
+
+// send writes a raw payload to the mDNS group on one interface. It is used
+// by components that originate their own packets (e.g. health probes).
+func (r *Reflector) send(wire []byte, ifaceName string) {
+	if r.paused.Load() || r.config().ObserveOnly {
+		return
+	}
+	ifi := r.iface(ifaceName)
+	if ifi == nil {
+		return
+	}
+	cm := &ipv4.ControlMessage{IfIndex: ifi.Index}
+	if _, err := r.connFor(ifaceName).WriteTo(wire, cm, mdnsGroup); err != nil {
+		r.reportError(errForward, "sending on "+ifaceName, err)
+		r.noteSendError(ifaceName, err)
+	} else {
+		r.noteSendOK(ifaceName)
+		r.pdedup.note(wire, ifaceName)
+	}
+}
+
+// iface returns the cached interface for a configured name, or nil. The
+// cache is refreshed by interface recovery, hence the locking.
+func (r *Reflector) iface(name string) *net.Interface {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ifaces[name]
+}
+
+// ifaceName returns the configured name for a kernel interface index.
+func (r *Reflector) ifaceName(ifindex int) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, ifi := range r.ifaces {
+		if ifi.Index == ifindex {
+			return name
+		}
+	}
+	return ""
+}
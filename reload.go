@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Config reload with a dry-run diff. Before a new config is applied, the
+// compiled policies are compared and the differences rendered as
+// human-readable lines (rules added/removed/changed, interfaces
+// joined/left). Destructive changes — anything that stops traffic that
+// flows today — are staged and require an explicit confirm call, so a
+// fat-fingered edit cannot cause a discovery outage in one step.
+
+// policyDiff is the comparison of two configs.
+type policyDiff struct {
+	Lines       []string `json:"lines"`
+	Destructive bool     `json:"destructive"`
+}
+
+// describeRule renders a rule compactly for diff lines.
+func describeRule(rule *Rule) string {
+	var b strings.Builder
+	if rule.Name != "" {
+		fmt.Fprintf(&b, "%q ", rule.Name)
+	}
+	fmt.Fprintf(&b, "%s -> %s", rule.From, strings.Join(rule.To, ","))
+	f := &rule.Filter
+	if len(f.Types) > 0 {
+		fmt.Fprintf(&b, " types=%s", strings.Join(f.Types, ","))
+	}
+	if len(f.Profiles) > 0 {
+		fmt.Fprintf(&b, " profiles=%s", strings.Join(f.Profiles, ","))
+	}
+	if len(f.AllowedServices) > 0 {
+		fmt.Fprintf(&b, " services=%s", strings.Join(f.AllowedServices, ","))
+	}
+	if len(f.AllowedIPs) > 0 {
+		fmt.Fprintf(&b, " ips=%d", len(f.AllowedIPs))
+	}
+	if len(f.AllowedMACs) > 0 {
+		fmt.Fprintf(&b, " macs=%d", len(f.AllowedMACs))
+	}
+	return b.String()
+}
+
+// diffPolicies compares old and new configs. Removing or narrowing a rule
+// and detaching an interface count as destructive; additions do not.
+func diffPolicies(old, new *Config) policyDiff {
+	var d policyDiff
+	for i := 0; i < len(old.Rules) || i < len(new.Rules); i++ {
+		switch {
+		case i >= len(old.Rules):
+			d.Lines = append(d.Lines, fmt.Sprintf("rule %d added: %s", i, describeRule(&new.Rules[i])))
+		case i >= len(new.Rules):
+			d.Lines = append(d.Lines, fmt.Sprintf("rule %d removed: %s", i, describeRule(&old.Rules[i])))
+			d.Destructive = true
+		default:
+			was, now := describeRule(&old.Rules[i]), describeRule(&new.Rules[i])
+			if was != now {
+				d.Lines = append(d.Lines, fmt.Sprintf("rule %d changed: %s => %s", i, was, now))
+				d.Destructive = true
+			}
+		}
+	}
+	oldIfaces, newIfaces := ifaceGroups(old), ifaceGroups(new)
+	names := make([]string, 0, len(oldIfaces)+len(newIfaces))
+	seen := make(map[string]bool)
+	for name := range oldIfaces {
+		names = append(names, name)
+		seen[name] = true
+	}
+	for name := range newIfaces {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		was, now := oldIfaces[name], newIfaces[name]
+		switch {
+		case was == "":
+			d.Lines = append(d.Lines, fmt.Sprintf("interface %s joins group %q", name, now))
+		case now == "":
+			d.Lines = append(d.Lines, fmt.Sprintf("interface %s leaves group %q", name, was))
+			d.Destructive = true
+		case was != now:
+			d.Lines = append(d.Lines, fmt.Sprintf("interface %s moves from group %q to %q", name, was, now))
+			d.Destructive = true
+		}
+	}
+	if len(old.Clients) != len(new.Clients) {
+		d.Lines = append(d.Lines, fmt.Sprintf("client overrides: %d => %d", len(old.Clients), len(new.Clients)))
+	}
+	return d
+}
+
+// ifaceGroups maps every configured interface to its group name.
+func ifaceGroups(cfg *Config) map[string]string {
+	out := make(map[string]string)
+	for i := range cfg.Groups {
+		for _, name := range cfg.Groups[i].Interfaces {
+			out[name] = cfg.Groups[i].Name
+		}
+	}
+	return out
+}
+
+// applyConfig swaps the packet-path policy to a validated new config:
+// multicast joins follow the interface delta, the prefilters are rebuilt,
+// and the config pointer is replaced. Listener-level settings (api, vrf
+// sockets, exporters) keep their startup values until restart.
+func (r *Reflector) applyConfig(nc *Config) error {
+	old := r.config()
+	oldIfaces, newIfaces := ifaceGroups(old), ifaceGroups(nc)
+
+	resolved := make(map[string]*net.Interface)
+	for name := range newIfaces {
+		ifi, err := net.InterfaceByName(name)
+		if err != nil {
+			return fmt.Errorf("interface %s: %w", name, err)
+		}
+		resolved[name] = ifi
+	}
+	for name := range newIfaces {
+		if _, had := oldIfaces[name]; !had {
+			if err := r.connFor(name).JoinGroup(resolved[name], mdnsGroup); err != nil {
+				return fmt.Errorf("joining %s on %s: %w", mdnsGroup.IP, name, err)
+			}
+		}
+	}
+	for name := range oldIfaces {
+		if _, keep := newIfaces[name]; !keep {
+			if ifi := r.iface(name); ifi != nil {
+				r.connFor(name).LeaveGroup(ifi, mdnsGroup)
+			}
+		}
+	}
+
+	r.cfgMu.Lock()
+	r.cfg = nc
+	r.cfgMu.Unlock()
+
+	r.mu.Lock()
+	r.ifaces = resolved
+	r.ifaceIndex = make(map[int]*Group)
+	for gi := range nc.Groups {
+		g := &nc.Groups[gi]
+		for _, name := range g.Interfaces {
+			if _, ok := r.ifaceIndex[resolved[name].Index]; !ok {
+				r.ifaceIndex[resolved[name].Index] = g
+			}
+		}
+	}
+	r.queryPrefilter = buildPrefilters(nc)
+	r.buildBridgeMap()
+	r.mu.Unlock()
+	r.dedup.setConfig(&nc.QueryDedup)
+
+	metrics.SetRevision(nc.Revision)
+	r.events.setRevision(nc.Revision)
+	metrics.Inc("mdns_config_reloads_total", nil)
+	r.events.publish(Event{Type: "reload", Summary: "configuration applied, revision " + nc.Revision})
+	return nil
+}
+
+// startReloadSignal re-reads the config file and applies it on SIGHUP.
+// Unlike the API path there is no confirmation channel, so destructive
+// changes apply too; the diff is logged first so the journal shows what
+// the reload did. A config that fails to load or apply leaves the running
+// policy untouched.
+func startReloadSignal(r *Reflector) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, unix.SIGHUP)
+	go func() {
+		for range ch {
+			nc, err := LoadConfig(r.cfgPath)
+			if err != nil {
+				log.Printf("reload: %v", err)
+				metrics.Inc("mdns_config_reload_errors_total", nil)
+				continue
+			}
+			diff := diffPolicies(r.config(), nc)
+			for _, line := range diff.Lines {
+				log.Printf("reload diff: %s", line)
+			}
+			if err := r.applyConfig(nc); err != nil {
+				log.Printf("reload: %v", err)
+				metrics.Inc("mdns_config_reload_errors_total", nil)
+			}
+		}
+	}()
+}
+
+// staged holds a loaded-but-unapplied config awaiting confirmation.
+type stagedReload struct {
+	mu   sync.Mutex
+	cfg  *Config
+	diff policyDiff
+}
+
+var staged stagedReload
+
+// reloadHandler loads the config file again and diffs it against the live
+// policy:
+//
+//	POST /reload {"dry_run": true}   – report the diff only
+//	POST /reload {}                  – apply, unless destructive
+//	POST /reload {"force": true}     – apply even destructive changes
+//
+// A destructive diff without force is staged; POST /reload/confirm applies
+// it.
+func (a *apiServer) reloadHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		DryRun bool `json:"dry_run"`
+		Force  bool `json:"force"`
+	}
+	if req.ContentLength > 0 {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	nc, err := LoadConfig(a.r.cfgPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	diff := diffPolicies(a.r.config(), nc)
+	for _, line := range diff.Lines {
+		log.Printf("reload diff: %s", line)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case body.DryRun:
+		json.NewEncoder(w).Encode(struct {
+			policyDiff
+			Applied bool `json:"applied"`
+		}{diff, false})
+	case diff.Destructive && !body.Force:
+		staged.mu.Lock()
+		staged.cfg = nc
+		staged.diff = diff
+		staged.mu.Unlock()
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(struct {
+			policyDiff
+			Error string `json:"error"`
+		}{diff, "destructive changes staged; POST /reload/confirm to apply"})
+	default:
+		if err := a.r.applyConfig(nc); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			policyDiff
+			Applied bool `json:"applied"`
+		}{diff, true})
+	}
+}
+
+// confirmHandler applies a previously staged destructive reload.
+// configHandler is the declarative apply API: PUT the complete desired
+// YAML configuration and it is validated, diffed, applied atomically and
+// persisted to the config path. Pushing a config identical to the
+// running revision is a no-op, so infrastructure-as-code tooling can
+// converge repeatedly without churn.
+func (a *apiServer) configHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut {
+		http.Error(w, "PUT required", http.StatusMethodNotAllowed)
+		return
+	}
+	raw, err := io.ReadAll(io.LimitReader(req.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	nc, err := ParseConfig(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	type applyResult struct {
+		policyDiff
+		Applied  bool   `json:"applied"`
+		Revision string `json:"revision"`
+	}
+	if nc.Revision == a.r.config().Revision {
+		json.NewEncoder(w).Encode(applyResult{Applied: false, Revision: nc.Revision})
+		return
+	}
+	diff := diffPolicies(a.r.config(), nc)
+	for _, line := range diff.Lines {
+		log.Printf("config apply diff: %s", line)
+	}
+	if err := a.r.applyConfig(nc); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	// Persist the applied config so a restart comes back with it.
+	tmp := a.r.cfgPath + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err == nil {
+		err = os.Rename(tmp, a.r.cfgPath)
+	} else {
+		os.Remove(tmp)
+	}
+	if err != nil {
+		log.Printf("config apply: persisting to %s: %v", a.r.cfgPath, err)
+	}
+	a.r.events.publish(Event{
+		Type:    "config-apply",
+		Summary: fmt.Sprintf("declarative apply, revision %s, %d change(s)", nc.Revision, len(diff.Lines)),
+	})
+	json.NewEncoder(w).Encode(applyResult{policyDiff: diff, Applied: true, Revision: nc.Revision})
+}
+
+func (a *apiServer) confirmHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	staged.mu.Lock()
+	nc := staged.cfg
+	staged.cfg = nil
+	staged.mu.Unlock()
+	if nc == nil {
+		http.Error(w, "nothing staged", http.StatusNotFound)
+		return
+	}
+	if err := a.r.applyConfig(nc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Built-in responder. The reflector host usually has services of its own
+// worth advertising — SSH, the web admin — and running Avahi next to the
+// reflector means two daemons fighting over port 5353. Instead the
+// services are declared in config and the reflector answers queries for
+// them (and announces them at startup) on the interfaces of the selected
+// groups, using each interface's own address.
+
+// ResponderService is one advertised service instance.
+type ResponderService struct {
+	// Name is the human-visible instance name, e.g. "Router SSH".
+	Name string `yaml:"name"`
+	// Type is the service type, e.g. _ssh._tcp.
+	Type string `yaml:"type"`
+	Port uint16 `yaml:"port"`
+	// Groups limits where the service is advertised; empty means every
+	// configured group.
+	Groups []string `yaml:"groups"`
+	// TXT entries, in key=value form.
+	TXT []string `yaml:"txt"`
+}
+
+// ResponderConfig declares the host's own services.
+type ResponderConfig struct {
+	// Hostname overrides the advertised host name; default is the OS
+	// hostname.
+	Hostname string             `yaml:"hostname"`
+	Services []ResponderService `yaml:"services"`
+}
+
+// validate checks the responder declarations against the group list.
+func (c *ResponderConfig) validate(groups map[string]bool) error {
+	for i := range c.Services {
+		s := &c.Services[i]
+		if s.Name == "" || s.Type == "" {
+			return fmt.Errorf("responder service %d: name and type are required", i)
+		}
+		if !strings.HasPrefix(s.Type, "_") {
+			return fmt.Errorf("responder service %q: type %q must start with _", s.Name, s.Type)
+		}
+		vetServiceType(s.Type, "responder.services")
+		if s.Port == 0 {
+			return fmt.Errorf("responder service %q: port is required", s.Name)
+		}
+		for _, g := range s.Groups {
+			if !groups[g] {
+				return fmt.Errorf("responder service %q: unknown group %q", s.Name, g)
+			}
+		}
+	}
+	return nil
+}
+
+// responder answers mDNS queries for the host's own services.
+type responder struct {
+	r        *Reflector
+	cfg      *ResponderConfig
+	hostname string
+}
+
+func newResponder(r *Reflector, cfg *ResponderConfig) *responder {
+	if len(cfg.Services) == 0 {
+		return nil
+	}
+	hostname := cfg.Hostname
+	if hostname == "" {
+		if h, err := os.Hostname(); err == nil {
+			hostname = h
+		} else {
+			hostname = "mdns-reflector"
+		}
+	}
+	// Strip any domain; mDNS names live under .local.
+	if i := strings.IndexByte(hostname, '.'); i > 0 {
+		hostname = hostname[:i]
+	}
+	return &responder{r: r, cfg: cfg, hostname: hostname}
+}
+
+// hostFQDN is the advertised host name on the wire.
+func (rd *responder) hostFQDN() string {
+	return rd.hostname + ".local."
+}
+
+// servesGroup reports whether a service is advertised to a group.
+func (s *ResponderService) servesGroup(group string) bool {
+	if len(s.Groups) == 0 {
+		return true
+	}
+	for _, g := range s.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// ifaceAddr returns an interface's primary IPv4 address.
+func ifaceAddr(ifi *net.Interface) net.IP {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if ipn, ok := a.(*net.IPNet); ok {
+			if v4 := ipn.IP.To4(); v4 != nil {
+				return v4
+			}
+		}
+	}
+	return nil
+}
+
+// records builds the record set for one service on one interface:
+// PTR + SRV + TXT + A, the unique ones with the cache-flush bit when
+// flush is set (announcements).
+func (rd *responder) records(s *ResponderService, addr net.IP, flush bool) (ptr dns.RR, unique []dns.RR) {
+	typeName := s.Type + ".local."
+	instance := s.Name + "." + typeName
+	class := uint16(dns.ClassINET)
+	if flush {
+		// The cache-flush bit shares the top class bit with QU.
+		class |= classQU
+	}
+	ptr = &dns.PTR{
+		Hdr: dns.RR_Header{Name: typeName, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 4500},
+		Ptr: instance,
+	}
+	unique = append(unique,
+		&dns.SRV{
+			Hdr:    dns.RR_Header{Name: instance, Rrtype: dns.TypeSRV, Class: class, Ttl: 120},
+			Port:   s.Port,
+			Target: rd.hostFQDN(),
+		},
+		&dns.TXT{
+			Hdr: dns.RR_Header{Name: instance, Rrtype: dns.TypeTXT, Class: class, Ttl: 4500},
+			Txt: append([]string{}, s.TXT...),
+		},
+	)
+	if addr != nil {
+		unique = append(unique, &dns.A{
+			Hdr: dns.RR_Header{Name: rd.hostFQDN(), Rrtype: dns.TypeA, Class: class, Ttl: 120},
+			A:   addr,
+		})
+	}
+	return ptr, unique
+}
+
+// answer responds to a query that asks for one of the host's services.
+// The answer is multicast on the interface the query arrived on.
+func (rd *responder) answer(pkt *packet, srcIface string, group *Group) {
+	if rd == nil || pkt.msg.Response || srcIface == "" {
+		return
+	}
+	ifi := rd.r.iface(srcIface)
+	if ifi == nil {
+		return
+	}
+	addr := ifaceAddr(ifi)
+	resp := new(dns.Msg)
+	resp.Response = true
+	resp.Authoritative = true
+	for _, q := range pkt.msg.Question {
+		name := strings.ToLower(q.Name)
+		for i := range rd.cfg.Services {
+			s := &rd.cfg.Services[i]
+			if !s.servesGroup(group.Name) {
+				continue
+			}
+			typeName := strings.ToLower(s.Type + ".local.")
+			instance := strings.ToLower(s.Name + "." + typeName)
+			switch {
+			case name == typeName && (q.Qtype == dns.TypePTR || q.Qtype == dns.TypeANY):
+				ptr, unique := rd.records(s, addr, false)
+				resp.Answer = append(resp.Answer, ptr)
+				resp.Extra = append(resp.Extra, unique...)
+			case name == instance && (q.Qtype == dns.TypeSRV || q.Qtype == dns.TypeTXT || q.Qtype == dns.TypeANY):
+				_, unique := rd.records(s, addr, false)
+				resp.Answer = append(resp.Answer, unique...)
+			case name == strings.ToLower(rd.hostFQDN()) && (q.Qtype == dns.TypeA || q.Qtype == dns.TypeANY) && addr != nil:
+				resp.Answer = append(resp.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: rd.hostFQDN(), Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 120},
+					A:   addr,
+				})
+			}
+		}
+	}
+	if len(resp.Answer) == 0 {
+		return
+	}
+	wire, err := resp.Pack()
+	if err != nil {
+		return
+	}
+	rd.r.send(wire, srcIface)
+	metrics.Inc("mdns_responder_answers_total", Labels{"iface": srcIface})
+}
+
+// announce sends the startup announcements: two multicast responses per
+// interface, one second apart (RFC 6762 §8.3), with cache-flush set on
+// the unique records.
+func (rd *responder) announce() {
+	if rd == nil {
+		return
+	}
+	cfg := rd.r.config()
+	for round := 0; round < 2; round++ {
+		if round > 0 {
+			time.Sleep(time.Second)
+		}
+		for gi := range cfg.Groups {
+			g := &cfg.Groups[gi]
+			for _, name := range g.Interfaces {
+				ifi := rd.r.iface(name)
+				if ifi == nil {
+					continue
+				}
+				addr := ifaceAddr(ifi)
+				resp := new(dns.Msg)
+				resp.Response = true
+				resp.Authoritative = true
+				for i := range rd.cfg.Services {
+					s := &rd.cfg.Services[i]
+					if !s.servesGroup(g.Name) {
+						continue
+					}
+					ptr, unique := rd.records(s, addr, true)
+					resp.Answer = append(resp.Answer, ptr)
+					resp.Answer = append(resp.Answer, unique...)
+				}
+				if len(resp.Answer) == 0 {
+					continue
+				}
+				if wire, err := resp.Pack(); err == nil {
+					rd.r.send(wire, name)
+				}
+			}
+		}
+	}
+	log.Printf("responder: %d service(s) announced as %s", len(rd.cfg.Services), rd.hostFQDN())
+}
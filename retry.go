@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Query retry. Multicast delivery on Wi-Fi IoT segments is lossy enough
+// that a reflected query regularly vanishes before any responder hears
+// it. When no response comes back within a deadline the query is resent to
+// the same destinations a bounded number of times with backoff.
+
+// QueryRetryConfig enables retries by setting a deadline.
+type QueryRetryConfig struct {
+	// DeadlineMS is how long to wait for a response before resending;
+	// 0 disables retries.
+	DeadlineMS int `yaml:"deadline_ms"`
+	// Attempts bounds the resends per query; default 2.
+	Attempts int `yaml:"attempts"`
+	// BackoffMS is added to the deadline after each resend; defaults to
+	// deadline_ms.
+	BackoffMS int `yaml:"backoff_ms"`
+}
+
+func (c *QueryRetryConfig) enabled() bool { return c.DeadlineMS > 0 }
+
+// pendingRetry is one forwarded query still waiting for a response.
+type pendingRetry struct {
+	wire     []byte
+	dsts     []string
+	srcIface string
+	attempts int
+	due      time.Time
+}
+
+// retrier tracks forwarded queries per source interface — the same
+// granularity the response window uses.
+type retrier struct {
+	r  *Reflector
+	mu sync.Mutex
+	// pending is keyed by source interface; a newer query from the same
+	// segment replaces the older one, matching the window semantics.
+	pending map[string]*pendingRetry
+}
+
+func newRetrier(r *Reflector) *retrier {
+	return &retrier{r: r, pending: make(map[string]*pendingRetry)}
+}
+
+// track registers a forwarded query for retry.
+func (t *retrier) track(pkt *packet, srcIface string, dsts []string, wire []byte) {
+	cfg := &t.r.config().QueryRetry
+	if !cfg.enabled() || pkt.msg.Response || srcIface == "" {
+		return
+	}
+	t.mu.Lock()
+	t.pending[srcIface] = &pendingRetry{
+		wire:     append([]byte(nil), wire...),
+		dsts:     dsts,
+		srcIface: srcIface,
+		due:      time.Now().Add(time.Duration(cfg.DeadlineMS) * time.Millisecond),
+	}
+	t.mu.Unlock()
+}
+
+// satisfied cancels the retry once a response flowed back to the segment.
+func (t *retrier) satisfied(srcIface string) {
+	t.mu.Lock()
+	delete(t.pending, srcIface)
+	t.mu.Unlock()
+}
+
+// run resends overdue queries until their attempts are spent.
+func (t *retrier) run() {
+	for range time.Tick(50 * time.Millisecond) {
+		cfg := &t.r.config().QueryRetry
+		if !cfg.enabled() {
+			continue
+		}
+		attempts := cfg.Attempts
+		if attempts <= 0 {
+			attempts = 2
+		}
+		backoff := cfg.BackoffMS
+		if backoff <= 0 {
+			backoff = cfg.DeadlineMS
+		}
+		now := time.Now()
+		var resend []*pendingRetry
+		t.mu.Lock()
+		for key, p := range t.pending {
+			if now.Before(p.due) {
+				continue
+			}
+			p.attempts++
+			if p.attempts > attempts {
+				delete(t.pending, key)
+				metrics.Inc("mdns_retry_exhausted_total", Labels{"iface": p.srcIface})
+				continue
+			}
+			p.due = now.Add(time.Duration(cfg.DeadlineMS+backoff*p.attempts) * time.Millisecond)
+			resend = append(resend, p)
+		}
+		t.mu.Unlock()
+		for _, p := range resend {
+			for _, dst := range p.dsts {
+				t.r.send(p.wire, dst)
+			}
+			metrics.Inc("mdns_retries_total", Labels{"iface": p.srcIface})
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Record scrubbing. Allow/deny works at packet granularity; some
+// deployments need to operate inside the message. The canonical case is
+// an IPv4-only routed boundary: reflected AAAA records make clients try
+// IPv6 addresses no firewall rule will ever carry, and every connection
+// starts with a timeout. A rule's scrub section strips named record
+// types or owner names from the responses it reflects, and the message
+// is repacked before forwarding. The stripping applies both to responses
+// the rule forwards directly and to responses relayed back through a
+// window the rule opened.
+
+// ScrubConfig lists what a rule removes from reflected responses.
+type ScrubConfig struct {
+	// Types are record type names to strip, e.g. [AAAA, NSEC, OPT].
+	Types []string `yaml:"types"`
+	// Names are owner names to strip; a leading "*." matches any name
+	// under the rest, so "*._airplay._tcp.local" covers every instance.
+	Names []string `yaml:"names"`
+
+	types    map[uint16]bool
+	names    map[string]bool
+	suffixes []string
+}
+
+// compile resolves type names and normalizes owner names.
+func (c *ScrubConfig) compile() error {
+	if len(c.Types) == 0 && len(c.Names) == 0 {
+		return nil
+	}
+	c.types = make(map[uint16]bool)
+	for _, t := range c.Types {
+		rrtype, ok := dns.StringToType[strings.ToUpper(t)]
+		if !ok {
+			return fmt.Errorf("scrub: unknown record type %q", t)
+		}
+		c.types[rrtype] = true
+	}
+	c.names = make(map[string]bool)
+	for _, n := range c.Names {
+		n = strings.ToLower(dns.Fqdn(n))
+		if rest, ok := strings.CutPrefix(n, "*."); ok {
+			c.suffixes = append(c.suffixes, "."+rest)
+			continue
+		}
+		c.names[n] = true
+	}
+	return nil
+}
+
+// active reports whether the rule scrubs anything.
+func (c *ScrubConfig) active() bool {
+	return len(c.types) > 0 || len(c.names) > 0 || len(c.suffixes) > 0
+}
+
+// drops reports whether one record is stripped.
+func (c *ScrubConfig) drops(rr dns.RR) bool {
+	hdr := rr.Header()
+	if c.types[hdr.Rrtype] {
+		return true
+	}
+	name := strings.ToLower(hdr.Name)
+	if c.names[name] {
+		return true
+	}
+	for _, suffix := range c.suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply removes the configured records from a message, reporting whether
+// anything was stripped.
+func (c *ScrubConfig) apply(msg *dns.Msg) (*dns.Msg, bool) {
+	changed := false
+	out := msg.Copy()
+	for _, set := range []*[]dns.RR{&out.Answer, &out.Ns, &out.Extra} {
+		kept := (*set)[:0]
+		for _, rr := range *set {
+			if c.drops(rr) {
+				changed = true
+				continue
+			}
+			kept = append(kept, rr)
+		}
+		*set = kept
+	}
+	return out, changed
+}
+
+// scrubPacket returns a repacked copy of a response with the configured
+// records stripped, the original packet when nothing matched, or nil when
+// nothing is left worth forwarding.
+func (c *ScrubConfig) scrubPacket(pkt *packet, ruleLabel string) *packet {
+	if !c.active() || !pkt.msg.Response {
+		return pkt
+	}
+	msg, changed := c.apply(pkt.msg)
+	if !changed {
+		return pkt
+	}
+	metrics.Inc("mdns_scrubbed_responses_total", Labels{"rule": ruleLabel})
+	if len(msg.Answer) == 0 && len(msg.Ns) == 0 && len(msg.Extra) == 0 {
+		return nil
+	}
+	payload, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	out := *pkt
+	out.payload = payload
+	out.msg = msg
+	out.lax = false
+	return &out
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// shadowState holds a candidate configuration that is evaluated against
+// live traffic without being enforced, plus the tally of decision
+// differences versus the active config. Operators load a candidate with
+// POST /shadow/load, let it soak, and read GET /shadow/report before
+// cutting over.
+type shadowState struct {
+	mu      sync.Mutex
+	cfg     *Config
+	path    string
+	since   time.Time
+	packets int64
+	diffs   int64
+	recent  []shadowDiff
+}
+
+// shadowDiff is one observed disagreement between active and shadow.
+type shadowDiff struct {
+	Time    time.Time `json:"time"`
+	Iface   string    `json:"iface"`
+	SrcIP   string    `json:"src_ip"`
+	Summary string    `json:"summary"`
+	Active  string    `json:"active"`
+	Shadow  string    `json:"shadow"`
+}
+
+// shadowRecentMax bounds the retained diff examples.
+const shadowRecentMax = 100
+
+// evaluateVerdict runs the pure decision logic of a config against one
+// packet and renders the verdict as a comparable string. It mirrors
+// handlePacket's order of evaluation (client overrides, then rules) but
+// has no side effects.
+func evaluateVerdict(cfg *Config, pkt *packet, srcIface string) string {
+	group := cfg.classifyByName(pkt.src.IP, srcIface)
+	if group == nil {
+		return "ignored (no group)"
+	}
+	if ovr := cfg.clientOverride(pkt.src.IP); ovr != nil {
+		return fmt.Sprintf("client override %s", ovr.Policy)
+	}
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.From != group.Name {
+			continue
+		}
+		if !rule.Filter.match(pkt) {
+			continue
+		}
+		return fmt.Sprintf("reflected by %s to %v", rule.label(i), rule.To)
+	}
+	return "no rule matched"
+}
+
+// classifyByName resolves a group the way the reflector would, but using
+// the interface name so a shadow config needs no kernel state.
+func (c *Config) classifyByName(srcIP net.IP, ifaceName string) *Group {
+	for i := range c.Groups {
+		g := &c.Groups[i]
+		if len(g.subnets) > 0 && g.containsIP(srcIP) {
+			return g
+		}
+	}
+	for i := range c.Groups {
+		g := &c.Groups[i]
+		for _, name := range g.Interfaces {
+			if name == ifaceName {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+// compare evaluates one live packet under both configs and records any
+// disagreement.
+func (s *shadowState) compare(active *Config, pkt *packet, srcIface string) {
+	s.mu.Lock()
+	cfg := s.cfg
+	s.mu.Unlock()
+	if cfg == nil {
+		return
+	}
+	got := evaluateVerdict(active, pkt, srcIface)
+	want := evaluateVerdict(cfg, pkt, srcIface)
+	s.mu.Lock()
+	s.packets++
+	if got != want {
+		s.diffs++
+		d := shadowDiff{
+			Time: time.Now(), Iface: srcIface, SrcIP: pkt.src.IP.String(),
+			Summary: getMsgSummary(pkt.msg), Active: got, Shadow: want,
+		}
+		s.recent = append(s.recent, d)
+		if len(s.recent) > shadowRecentMax {
+			s.recent = s.recent[1:]
+		}
+	}
+	s.mu.Unlock()
+	metrics.Inc("mdns_shadow_packets_total", nil)
+	if got != want {
+		metrics.Inc("mdns_shadow_diffs_total", nil)
+	}
+}
+
+// shadowLoadHandler loads (or replaces) the shadow config:
+// POST /shadow/load {"path": "/etc/mdns-reflector/candidate.yaml"}
+func (a *apiServer) shadowLoadHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cfg, err := LoadConfig(body.Path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("candidate config rejected: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	a.r.shadow.mu.Lock()
+	a.r.shadow.cfg = cfg
+	a.r.shadow.path = body.Path
+	a.r.shadow.since = time.Now()
+	a.r.shadow.packets = 0
+	a.r.shadow.diffs = 0
+	a.r.shadow.recent = nil
+	a.r.shadow.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// shadowReportHandler serves GET /shadow/report; DELETE /shadow/report
+// unloads the candidate.
+func (a *apiServer) shadowReportHandler(w http.ResponseWriter, req *http.Request) {
+	s := a.r.shadow
+	if req.Method == http.MethodDelete {
+		s.mu.Lock()
+		s.cfg = nil
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"loaded":  s.cfg != nil,
+		"path":    s.path,
+		"since":   s.since,
+		"packets": s.packets,
+		"diffs":   s.diffs,
+		"recent":  s.recent,
+	})
+}
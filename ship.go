@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Remote log shipping. Router-local storage is usually tiny, so events can
+// be forwarded to a remote collector as HTTP bulk NDJSON with a bearer
+// token. Batches are buffered in memory and retried; when the collector
+// stays unreachable the oldest events are dropped rather than growing the
+// heap without bound.
+
+// ShipConfig enables the event shipper.
+type ShipConfig struct {
+	// URL receives POSTed batches of newline-delimited JSON events.
+	URL string `yaml:"url"`
+	// Token, if set, is sent as an Authorization bearer token.
+	Token string `yaml:"token"`
+	// BatchSize and IntervalSeconds bound how long events wait before a
+	// POST; defaults 100 events / 5 seconds.
+	BatchSize       int `yaml:"batch_size"`
+	IntervalSeconds int `yaml:"interval"`
+	// BufferLimit caps buffered events while the collector is down;
+	// default 10000.
+	BufferLimit int `yaml:"buffer_limit"`
+}
+
+type shipper struct {
+	cfg     *ShipConfig
+	privacy string
+	client  *http.Client
+	buf     []Event
+}
+
+// startShipper subscribes to the event bus and ships batches remotely.
+func startShipper(cfg *Config, r *Reflector) {
+	if cfg.Ship.URL == "" {
+		return
+	}
+	sc := &cfg.Ship
+	if sc.BatchSize <= 0 {
+		sc.BatchSize = 100
+	}
+	if sc.IntervalSeconds <= 0 {
+		sc.IntervalSeconds = 5
+	}
+	if sc.BufferLimit <= 0 {
+		sc.BufferLimit = 10000
+	}
+	s := &shipper{cfg: sc, privacy: cfg.Privacy.Ship, client: &http.Client{Timeout: 10 * time.Second}}
+	ch, _ := r.events.subscribe()
+	go s.run(ch)
+	log.Printf("shipping events to %s (batch %d, every %ds)", sc.URL, sc.BatchSize, sc.IntervalSeconds)
+}
+
+func (s *shipper) run(ch <-chan Event) {
+	tick := time.Tick(time.Duration(s.cfg.IntervalSeconds) * time.Second)
+	for {
+		select {
+		case ev := <-ch:
+			s.buf = append(s.buf, ev)
+			if len(s.buf) >= s.cfg.BufferLimit {
+				// Oldest first: recent events are worth more during an
+				// outage postmortem than the ones that preceded it.
+				drop := len(s.buf) - s.cfg.BufferLimit + 1
+				s.buf = append(s.buf[:0], s.buf[drop:]...)
+				metrics.Add("mdns_ship_dropped_total", nil, float64(drop))
+			}
+			if len(s.buf) >= s.cfg.BatchSize {
+				s.flush()
+			}
+		case <-tick:
+			s.flush()
+		}
+	}
+}
+
+// flush POSTs everything buffered; on failure the batch stays buffered for
+// the next attempt.
+func (s *shipper) flush() {
+	if len(s.buf) == 0 {
+		return
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, ev := range s.buf {
+		enc.Encode(scrubEvent(ev, s.privacy))
+	}
+	req, err := http.NewRequest(http.MethodPost, s.cfg.URL, &body)
+	if err != nil {
+		metrics.Inc("mdns_ship_errors_total", nil)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		metrics.Inc("mdns_ship_errors_total", nil)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		metrics.Inc("mdns_ship_errors_total", nil)
+		return
+	}
+	metrics.Add("mdns_shipped_total", nil, float64(len(s.buf)))
+	s.buf = s.buf[:0]
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Graceful shutdown. main used to park in select{} and die wherever the
+// signal found it, leaving multicast memberships for the kernel to reap
+// and any state export to luck. Now SIGTERM/SIGINT runs an orderly exit:
+// export state if configured, stop the listeners, let in-flight packets
+// drain, leave every joined group and close the sockets.
+
+// shutdownDrain bounds how long shutdown waits for the listen loops to
+// finish their current packet.
+const shutdownDrain = 2 * time.Second
+
+// runUntilSignal blocks main until SIGTERM or SIGINT, then shuts the
+// reflector down and returns the process exit code.
+func runUntilSignal(r *Reflector) int {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, unix.SIGTERM, unix.SIGINT)
+	sig := <-ch
+	log.Printf("received %s, shutting down", sig)
+	if path := r.config().StatePath; path != "" {
+		if err := r.exportState(path); err != nil {
+			log.Printf("state export: %v", err)
+		} else {
+			log.Printf("state exported to %s", path)
+		}
+	}
+	r.Shutdown()
+	return 0
+}
+
+// Shutdown stops the listen loops, waits briefly for them to drain,
+// leaves the multicast group on every attached interface and closes the
+// sockets.
+func (r *Reflector) Shutdown() {
+	r.closing.Store(true)
+	r.mu.Lock()
+	socks := make([]*vrfSocket, 0, len(r.socks))
+	for _, vs := range r.socks {
+		socks = append(socks, vs)
+	}
+	ifaces := make(map[string]*net.Interface, len(r.ifaces))
+	for name, ifi := range r.ifaces {
+		ifaces[name] = ifi
+	}
+	r.mu.Unlock()
+	for name, ifi := range ifaces {
+		if err := r.connFor(name).LeaveGroup(ifi, mdnsGroup); err != nil {
+			log.Printf("leaving %s on %s: %v", mdnsGroup.IP, name, err)
+		}
+	}
+	for _, vs := range socks {
+		vs.uc.Close()
+	}
+	done := make(chan struct{})
+	go func() {
+		r.listenWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownDrain):
+		log.Printf("shutdown: listeners did not drain within %s", shutdownDrain)
+	}
+	log.Printf("shutdown complete")
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// sloTracker measures discovery quality per service type: when a query is
+// reflected it opens an attempt, and a reflected response for the same
+// service within the query window closes it as a success, recording the
+// query-to-response latency. Attempts that see no response count as
+// failures. Results are bucketed per day and summarized on /slo.
+type sloTracker struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	pending map[string]time.Time      // service -> when the query was reflected
+	days    map[string]*sloDayBuckets // "2006-01-02" -> per-service buckets
+}
+
+type sloDayBuckets map[string]*sloBucket
+
+type sloBucket struct {
+	Attempts     int64         `json:"attempts"`
+	Successes    int64         `json:"successes"`
+	TotalLatency time.Duration `json:"-"`
+}
+
+// sloRetentionDays is how many daily buckets are kept; enough for the
+// weekly summary plus the current day.
+const sloRetentionDays = 8
+
+func newSLOTracker(window time.Duration) *sloTracker {
+	s := &sloTracker{
+		window:  window,
+		pending: make(map[string]time.Time),
+		days:    make(map[string]*sloDayBuckets),
+	}
+	go s.sweep()
+	return s
+}
+
+// querySent records a reflected query for each service it mentions.
+func (s *sloTracker) querySent(services []string) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, svc := range services {
+		if sent, ok := s.pending[svc]; ok && now.Sub(sent) >= s.window {
+			s.close(svc, sent, false, 0)
+		}
+		if _, ok := s.pending[svc]; !ok {
+			s.pending[svc] = now
+		}
+	}
+}
+
+// responseSeen closes pending attempts for the services the response
+// mentions, recording latency.
+func (s *sloTracker) responseSeen(services []string) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, svc := range services {
+		sent, ok := s.pending[svc]
+		if !ok {
+			continue
+		}
+		if now.Sub(sent) < s.window {
+			s.close(svc, sent, true, now.Sub(sent))
+		} else {
+			s.close(svc, sent, false, 0)
+		}
+	}
+}
+
+// close finalizes one attempt; the caller holds s.mu.
+func (s *sloTracker) close(svc string, sent time.Time, success bool, latency time.Duration) {
+	delete(s.pending, svc)
+	day := sent.Format("2006-01-02")
+	buckets, ok := s.days[day]
+	if !ok {
+		b := make(sloDayBuckets)
+		buckets = &b
+		s.days[day] = buckets
+		s.prune()
+	}
+	bucket := (*buckets)[svc]
+	if bucket == nil {
+		bucket = &sloBucket{}
+		(*buckets)[svc] = bucket
+	}
+	bucket.Attempts++
+	if success {
+		bucket.Successes++
+		bucket.TotalLatency += latency
+	}
+}
+
+// prune drops daily buckets beyond the retention horizon; caller holds s.mu.
+func (s *sloTracker) prune() {
+	cutoff := time.Now().AddDate(0, 0, -sloRetentionDays).Format("2006-01-02")
+	for day := range s.days {
+		if day < cutoff {
+			delete(s.days, day)
+		}
+	}
+}
+
+// sweep expires pending attempts that never saw a response.
+func (s *sloTracker) sweep() {
+	for range time.Tick(s.window) {
+		now := time.Now()
+		s.mu.Lock()
+		for svc, sent := range s.pending {
+			if now.Sub(sent) >= s.window {
+				s.close(svc, sent, false, 0)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// sloSummary is one service's aggregated numbers over a reporting period.
+type sloSummary struct {
+	Service      string  `json:"service"`
+	Attempts     int64   `json:"attempts"`
+	Successes    int64   `json:"successes"`
+	SuccessRate  float64 `json:"success_rate"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// summarize aggregates the last n days into per-service summaries.
+func (s *sloTracker) summarize(n int) []sloSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agg := make(map[string]*sloBucket)
+	for i := 0; i < n; i++ {
+		day := time.Now().AddDate(0, 0, -i).Format("2006-01-02")
+		buckets, ok := s.days[day]
+		if !ok {
+			continue
+		}
+		for svc, b := range *buckets {
+			a := agg[svc]
+			if a == nil {
+				a = &sloBucket{}
+				agg[svc] = a
+			}
+			a.Attempts += b.Attempts
+			a.Successes += b.Successes
+			a.TotalLatency += b.TotalLatency
+		}
+	}
+	out := make([]sloSummary, 0, len(agg))
+	for svc, b := range agg {
+		sum := sloSummary{Service: svc, Attempts: b.Attempts, Successes: b.Successes}
+		if b.Attempts > 0 {
+			sum.SuccessRate = float64(b.Successes) / float64(b.Attempts)
+		}
+		if b.Successes > 0 {
+			sum.AvgLatencyMs = float64(b.TotalLatency.Milliseconds()) / float64(b.Successes)
+		}
+		out = append(out, sum)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Service < out[j].Service })
+	return out
+}
+
+// ServeHTTP reports daily and weekly summaries as JSON.
+func (s *sloTracker) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]sloSummary{
+		"daily":  s.summarize(1),
+		"weekly": s.summarize(7),
+	})
+}
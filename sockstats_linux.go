@@ -0,0 +1,92 @@
+//go:build linux
+
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// socket statistics polling: the kernel silently drops datagrams when the
+// receive buffer overflows, which looks exactly like "mDNS doesn't work".
+// Every poll interval the reflector's own UDP socket is located in
+// /proc/net/udp (the procfs view of sock_diag) by inode and its queue
+// depth and cumulative drop counter are exported.
+
+const socketStatsInterval = 15 * time.Second
+
+// startSocketStats launches the statistics poller.
+func startSocketStats(r *Reflector) {
+	go func() {
+		var lastDrops uint64
+		var haveLast bool
+		for range time.Tick(socketStatsInterval) {
+			inode, err := r.socketInode()
+			if err != nil {
+				continue
+			}
+			rxQueue, drops, ok := readUDPSocketStats(inode)
+			if !ok {
+				continue
+			}
+			metrics.Set("mdns_socket_rx_queue_bytes", nil, float64(rxQueue))
+			if haveLast && drops >= lastDrops {
+				if delta := drops - lastDrops; delta > 0 {
+					metrics.Add("mdns_socket_drops_total", nil, float64(delta))
+					log.Printf("kernel dropped %d datagram(s) on the mDNS socket since last poll (receive buffer overflow)", delta)
+				}
+			}
+			lastDrops = drops
+			haveLast = true
+		}
+	}()
+}
+
+// socketInode returns the inode of the current mDNS socket. It is fetched
+// on every poll because socket rebuilds change it.
+func (r *Reflector) socketInode() (uint64, error) {
+	raw, err := r.uc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var ino uint64
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		var st unix.Stat_t
+		serr = unix.Fstat(int(fd), &st)
+		ino = st.Ino
+	})
+	if err != nil {
+		return 0, err
+	}
+	return ino, serr
+}
+
+// readUDPSocketStats finds the socket with the given inode in
+// /proc/net/udp and returns its receive queue depth in bytes and its
+// cumulative drop counter.
+func readUDPSocketStats(inode uint64) (rxQueue, drops uint64, ok bool) {
+	raw, err := os.ReadFile("/proc/net/udp")
+	if err != nil {
+		return 0, 0, false
+	}
+	want := strconv.FormatUint(inode, 10)
+	for _, line := range strings.Split(string(raw), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 13 || fields[9] != want {
+			continue
+		}
+		queues := strings.Split(fields[4], ":")
+		if len(queues) == 2 {
+			rxQueue, _ = strconv.ParseUint(queues[1], 16, 64)
+		}
+		drops, _ = strconv.ParseUint(fields[12], 10, 64)
+		return rxQueue, drops, true
+	}
+	return 0, 0, false
+}
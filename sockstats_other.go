@@ -0,0 +1,6 @@
+//go:build !linux
+
+package main
+
+// startSocketStats is a no-op on platforms without a procfs socket table.
+func startSocketStats(*Reflector) {}
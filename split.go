@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/ipv4"
+)
+
+// Multi-packet response splitting. Family transforms (synthesize-aaaa) and
+// future aggregation can grow a response past the destination MTU; an
+// oversized datagram gets IP-fragmented or silently dropped by many Wi-Fi
+// stacks. RFC 6762 §17 allows a responder to spread its answers over
+// several messages, so an oversized response is re-cut into multiple legal
+// ones instead.
+
+// splitMessage cuts a message into chunks whose estimated wire size stays
+// under limit. Answers are distributed greedily in order; additional
+// records follow once the answers are exhausted. A single record larger
+// than the limit still gets its own message — there is no smaller legal
+// form to send.
+func splitMessage(msg *dns.Msg, limit int) []*dns.Msg {
+	newChunk := func() *dns.Msg {
+		c := new(dns.Msg)
+		c.MsgHdr = msg.MsgHdr
+		c.Compress = true
+		return c
+	}
+	var out []*dns.Msg
+	cur := newChunk()
+	flush := func() {
+		if len(cur.Answer) > 0 || len(cur.Extra) > 0 {
+			out = append(out, cur)
+			cur = newChunk()
+		}
+	}
+	add := func(rr dns.RR, extra bool) {
+		if cur.Len()+dns.Len(rr) > limit {
+			flush()
+		}
+		if extra {
+			cur.Extra = append(cur.Extra, rr)
+		} else {
+			cur.Answer = append(cur.Answer, rr)
+		}
+	}
+	for _, rr := range msg.Answer {
+		add(rr, false)
+	}
+	for _, rr := range msg.Extra {
+		add(rr, true)
+	}
+	flush()
+	return out
+}
+
+// sendSplit re-cuts an oversized response and writes the pieces to one
+// destination interface, each piece passing the budget individually.
+func (r *Reflector) sendSplit(oversized []byte, name string, ifi *net.Interface, mtu int) {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(oversized); err != nil {
+		r.reportError(errParse, "splitting oversized response for "+name, err)
+		return
+	}
+	// Leave headroom for the IP and UDP headers.
+	chunks := splitMessage(msg, mtu-28)
+	metrics.Inc("mdns_split_total", Labels{"iface": name})
+	cm := &ipv4.ControlMessage{IfIndex: ifi.Index}
+	conn := r.connFor(name)
+	for _, chunk := range chunks {
+		wire, err := chunk.Pack()
+		if err != nil {
+			r.reportError(errParse, "packing split response for "+name, err)
+			continue
+		}
+		if !r.budgetAllows(name, len(wire), false) {
+			continue
+		}
+		if _, err := conn.WriteTo(wire, cm, mdnsGroup); err != nil {
+			r.reportError(errForward, "forwarding split response to "+name, err)
+			r.noteSendError(name, err)
+			return
+		}
+		r.noteSendOK(name)
+	}
+}
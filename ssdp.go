@@ -0,0 +1,137 @@
+package main
+
+import (
+	"log"
+	"net"
+	"strings"
+
+	"golang.org/x/net/ipv4"
+)
+
+// SSDP reflection. Some ecosystems (Sonos foremost) discover over UPnP
+// SSDP alongside mDNS: the controller multicasts an M-SEARCH for a device
+// type and devices multicast NOTIFY announcements. Rules whose filters
+// reference a profile with SSDP targets get those two message kinds
+// reflected along the same from/to edges as their mDNS traffic; unicast
+// M-SEARCH responses ride normal routing and need no help.
+
+// ssdpGroup is the UPnP discovery address.
+var ssdpGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+type ssdpReflector struct {
+	r    *Reflector
+	conn *ipv4.PacketConn
+	// routes maps a source ifindex to destinations, targets holds the
+	// UPnP device types worth reflecting.
+	routes  map[int][]string
+	targets []string
+}
+
+// startSSDP opens the SSDP socket when any rule references a profile with
+// SSDP targets.
+func startSSDP(cfg *Config, r *Reflector) *ssdpReflector {
+	routes := make(map[int][]string)
+	var targets []string
+	seen := make(map[string]bool)
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		var ruleTargets []string
+		for _, p := range rule.Filter.Profiles {
+			ruleTargets = append(ruleTargets, profileSSDPTargets[p]...)
+		}
+		if len(ruleTargets) == 0 {
+			continue
+		}
+		for _, t := range ruleTargets {
+			if !seen[t] {
+				seen[t] = true
+				targets = append(targets, t)
+			}
+		}
+		from := cfg.group(rule.From)
+		dsts := r.ruleDestinations(rule, "")
+		for _, name := range from.Interfaces {
+			if ifi := r.iface(name); ifi != nil {
+				routes[ifi.Index] = append(routes[ifi.Index], dsts...)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	uc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: ssdpGroup.Port})
+	if err != nil {
+		log.Printf("ssdp: %v", err)
+		return nil
+	}
+	conn := ipv4.NewPacketConn(uc)
+	if err := conn.SetControlMessage(ipv4.FlagInterface, true); err != nil {
+		uc.Close()
+		log.Printf("ssdp: %v", err)
+		return nil
+	}
+	conn.SetMulticastLoopback(false)
+	for ifindex := range routes {
+		if name := r.ifaceName(ifindex); name != "" {
+			if ifi := r.iface(name); ifi != nil {
+				if err := conn.JoinGroup(ifi, ssdpGroup); err != nil {
+					log.Printf("ssdp: joining on %s: %v", name, err)
+				}
+			}
+		}
+	}
+	s := &ssdpReflector{r: r, conn: conn, routes: routes, targets: targets}
+	go s.listen(uc)
+	log.Printf("ssdp reflection active for %d device type(s)", len(targets))
+	return s
+}
+
+func (s *ssdpReflector) listen(uc *net.UDPConn) {
+	buf := make([]byte, 4096)
+	oob := make([]byte, 64)
+	for {
+		n, oobn, _, src, err := uc.ReadMsgUDP(buf, oob)
+		if err != nil {
+			log.Printf("ssdp: %v", err)
+			return
+		}
+		ifindex := sys.ParseOOB(oob[:oobn]).ifindex
+		dsts := s.routes[ifindex]
+		if len(dsts) == 0 || !s.wanted(buf[:n]) {
+			continue
+		}
+		srcIface := s.r.ifaceName(ifindex)
+		for _, name := range dsts {
+			ifi := s.r.iface(name)
+			if ifi == nil || name == srcIface {
+				continue
+			}
+			cm := &ipv4.ControlMessage{IfIndex: ifi.Index}
+			if _, err := s.conn.WriteTo(buf[:n], cm, ssdpGroup); err != nil {
+				s.r.reportError(errForward, "reflecting ssdp to "+name, err)
+				continue
+			}
+			metrics.Inc("mdns_ssdp_reflected_total", Labels{"iface": srcIface})
+		}
+		_ = src
+	}
+}
+
+// wanted reports whether an SSDP datagram concerns a reflected device
+// type: an M-SEARCH or NOTIFY whose ST/NT names one of the targets, or a
+// broad ssdp:all / root-device search that a matching device would answer.
+func (s *ssdpReflector) wanted(payload []byte) bool {
+	text := string(payload)
+	if !strings.HasPrefix(text, "M-SEARCH ") && !strings.HasPrefix(text, "NOTIFY ") {
+		return false
+	}
+	if strings.Contains(text, "ssdp:all") || strings.Contains(text, "upnp:rootdevice") {
+		return true
+	}
+	for _, t := range s.targets {
+		if strings.Contains(text, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Runtime state export/import. On a large network the inventory and the
+// open response windows take minutes to repopulate after a restart, and
+// until they do discovery is degraded. With state_path set the daemon
+// writes its soft state to disk on shutdown and the next process reads it
+// back at startup, so a binary upgrade causes no discovery blackout. The
+// file is soft state only — deleting it is always safe.
+
+// stateMaxAge discards an exported file older than this at import;
+// windows and dedup entries from a long-dead process are worthless.
+const stateMaxAge = 5 * time.Minute
+
+// savedState is the on-disk snapshot format.
+type savedState struct {
+	SavedAt   time.Time              `json:"saved_at"`
+	Inventory []inventoryEntry       `json:"inventory"`
+	Windows   map[string]savedWindow `json:"windows"`
+	Dedup     map[string]time.Time   `json:"dedup"`
+}
+
+// savedWindow is one open response window, keyed like recentQueries.
+type savedWindow struct {
+	When    time.Time `json:"when"`
+	ReplyTo []string  `json:"reply_to"`
+	Querier string    `json:"querier,omitempty"`
+}
+
+// exportState writes the current soft state to path (temp file + rename,
+// so a crash mid-write never leaves a torn file).
+func (r *Reflector) exportState(path string) error {
+	st := savedState{
+		SavedAt:   time.Now(),
+		Inventory: r.inv.snapshot(),
+		Windows:   make(map[string]savedWindow),
+		Dedup:     r.dedup.export(),
+	}
+	r.mu.Lock()
+	for key, q := range r.recentQueries {
+		w := savedWindow{When: q.when, ReplyTo: q.replyTo}
+		if q.querier != nil {
+			w.Querier = q.querier.String()
+		}
+		st.Windows[key] = w
+	}
+	r.mu.Unlock()
+	raw, err := json.Marshal(&st)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// importState restores soft state written by a previous process. The file
+// is removed afterwards so a crash loop cannot resurrect ancient state.
+func (r *Reflector) importState(path string) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("state import: %v", err)
+		}
+		return
+	}
+	os.Remove(path)
+	var st savedState
+	if err := json.Unmarshal(raw, &st); err != nil {
+		log.Printf("state import: %v", err)
+		return
+	}
+	if time.Since(st.SavedAt) > stateMaxAge {
+		log.Printf("state import: snapshot from %s too old, ignoring", st.SavedAt.Format(time.RFC3339))
+		return
+	}
+	r.inv.restore(st.Inventory)
+	r.dedup.restore(st.Dedup)
+	r.mu.Lock()
+	for key, w := range st.Windows {
+		q := &recentQuery{when: w.When, replyTo: w.ReplyTo}
+		if w.Querier != "" {
+			if addr, err := net.ResolveUDPAddr("udp4", w.Querier); err == nil {
+				q.querier = addr
+			}
+		}
+		r.recentQueries[key] = q
+	}
+	r.mu.Unlock()
+	log.Printf("state import: restored %d inventory entries, %d windows from %s",
+		len(st.Inventory), len(st.Windows), filepath.Base(path))
+}
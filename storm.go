@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Reflection loop brake. When another reflector (an Avahi box, a
+// misconfigured bridge) shares a segment with this one, each repeats the
+// other's output and a single packet ping-pongs forever. The brake
+// hashes every payload this reflector sends, per destination interface,
+// and drops an identical payload arriving back from that interface
+// within a short window: our own output echoed at us is the signature
+// of a loop, while the same payload arriving from the original sender's
+// interface (a legitimate repeat) is untouched.
+
+// PayloadDedupConfig tunes the storm brake.
+type PayloadDedupConfig struct {
+	// WindowMS is how long a sent payload's hash suppresses an
+	// identical arrival from the interface it was sent to. Default
+	// 500; -1 disables the brake.
+	WindowMS int `yaml:"window_ms"`
+
+	window time.Duration
+}
+
+// compile applies the default.
+func (c *PayloadDedupConfig) compile() error {
+	if c.WindowMS == 0 {
+		c.WindowMS = 500
+	}
+	if c.WindowMS < -1 {
+		return fmt.Errorf("payload_dedup: window_ms must be -1, 0 or positive")
+	}
+	c.window = time.Duration(c.WindowMS) * time.Millisecond
+	return nil
+}
+
+// payloadDedupCap bounds the hash table; beyond it, expired entries are
+// swept.
+const payloadDedupCap = 4096
+
+// sentKey identifies one (payload, destination interface) pair.
+type sentKey struct {
+	hash  uint64
+	iface string
+}
+
+type payloadDedup struct {
+	cfg  *PayloadDedupConfig
+	clk  clock
+	mu   sync.Mutex
+	sent map[sentKey]time.Time
+}
+
+func newPayloadDedup(cfg *PayloadDedupConfig) *payloadDedup {
+	return &payloadDedup{cfg: cfg, clk: realClock{}, sent: make(map[sentKey]time.Time)}
+}
+
+func payloadHash(payload []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(payload)
+	return h.Sum64()
+}
+
+// note records a payload this reflector just sent to one interface.
+func (d *payloadDedup) note(wire []byte, dstIface string) {
+	if d.cfg.WindowMS < 0 {
+		return
+	}
+	now := d.clk.Now()
+	key := sentKey{hash: payloadHash(wire), iface: dstIface}
+	d.mu.Lock()
+	if len(d.sent) >= payloadDedupCap {
+		for k, t := range d.sent {
+			if now.Sub(t) > d.cfg.window {
+				delete(d.sent, k)
+			}
+		}
+	}
+	d.sent[key] = now
+	d.mu.Unlock()
+}
+
+// drop reports whether an arriving payload is one this reflector sent to
+// the same interface within the window — the signature of a reflection
+// loop.
+func (d *payloadDedup) drop(payload []byte, srcIface string) bool {
+	if d.cfg.WindowMS < 0 || srcIface == "" {
+		return false
+	}
+	key := sentKey{hash: payloadHash(payload), iface: srcIface}
+	d.mu.Lock()
+	t, ok := d.sent[key]
+	d.mu.Unlock()
+	return ok && d.clk.Now().Sub(t) <= d.cfg.window
+}
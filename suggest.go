@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Policy suggestions. The reflector passively counts which service types
+// each group actually queries and answers for; from that, /suggest renders
+// tightened filter candidates ("users only ever query _airplay._tcp and
+// _ipp._tcp; suggested allowed_services below") so an initially permissive
+// config can be narrowed with evidence instead of guesswork.
+
+// suggestTracker accumulates per-group service usage.
+type suggestTracker struct {
+	mu    sync.Mutex
+	since time.Time
+	// queried[group][service] counts queries seen from the group,
+	// answered[group][service] counts responses.
+	queried  map[string]map[string]int
+	answered map[string]map[string]int
+}
+
+func newSuggestTracker() *suggestTracker {
+	return &suggestTracker{
+		since:    time.Now(),
+		queried:  make(map[string]map[string]int),
+		answered: make(map[string]map[string]int),
+	}
+}
+
+// observe folds one classified packet into the usage counts.
+func (t *suggestTracker) observe(group string, pkt *packet) {
+	services := pkt.services()
+	if len(services) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	table := t.queried
+	if pkt.msg.Response {
+		table = t.answered
+	}
+	m, ok := table[group]
+	if !ok {
+		m = make(map[string]int)
+		table[group] = m
+	}
+	for _, svc := range services {
+		m[svc]++
+	}
+}
+
+// serviceCount is one observed service with its packet count.
+type serviceCount struct {
+	Service string `json:"service"`
+	Count   int    `json:"count"`
+}
+
+// ruleSuggestion is the tightened filter candidate for one rule.
+type ruleSuggestion struct {
+	Rule              int            `json:"rule"`
+	Name              string         `json:"name,omitempty"`
+	Description       string         `json:"description,omitempty"`
+	From              string         `json:"from"`
+	To                []string       `json:"to"`
+	Observed          []serviceCount `json:"observed"`
+	AllowedServices   []string       `json:"suggested_allowed_services"`
+	AlreadyRestricted bool           `json:"already_restricted,omitempty"`
+}
+
+// suggestions renders a per-rule report from the usage seen so far.
+func (t *suggestTracker) suggestions(cfg *Config) []ruleSuggestion {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]ruleSuggestion, 0, len(cfg.Rules))
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		sg := ruleSuggestion{
+			Rule:              i,
+			Name:              rule.Name,
+			Description:       rule.Description,
+			From:              rule.From,
+			To:                rule.To,
+			AlreadyRestricted: len(rule.Filter.AllowedServices) > 0 || len(rule.Filter.Profiles) > 0,
+		}
+		for svc, n := range t.queried[rule.From] {
+			sg.Observed = append(sg.Observed, serviceCount{Service: svc, Count: n})
+		}
+		sort.Slice(sg.Observed, func(a, b int) bool {
+			if sg.Observed[a].Count != sg.Observed[b].Count {
+				return sg.Observed[a].Count > sg.Observed[b].Count
+			}
+			return sg.Observed[a].Service < sg.Observed[b].Service
+		})
+		for _, sc := range sg.Observed {
+			sg.AllowedServices = append(sg.AllowedServices, sc.Service)
+		}
+		out = append(out, sg)
+	}
+	return out
+}
+
+// suggestHandler serves the policy suggestion report:
+// GET /suggest
+func (a *apiServer) suggestHandler(w http.ResponseWriter, req *http.Request) {
+	a.r.suggest.mu.Lock()
+	since := a.r.suggest.since
+	a.r.suggest.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Since time.Time        `json:"since"`
+		Rules []ruleSuggestion `json:"rules"`
+	}{since, a.r.suggest.suggestions(a.r.config())})
+}
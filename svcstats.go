@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Per-service-type statistics. Policy and capacity decisions need to know
+// which protocols actually dominate a segment — a thousand _googlecast
+// queries an hour from the user VLAN argues for a dedicated rule, while a
+// service nobody queries can be dropped from an allowlist. Counts are kept
+// per group and service type, exported as metrics and summarized with
+// hourly rates on /services.
+
+type svcCount struct {
+	Queries   uint64 `json:"queries"`
+	Responses uint64 `json:"responses"`
+}
+
+type serviceStats struct {
+	mu    sync.Mutex
+	since time.Time
+	// counts maps group name -> service type -> counters.
+	counts map[string]map[string]*svcCount
+}
+
+func newServiceStats() *serviceStats {
+	return &serviceStats{since: time.Now(), counts: make(map[string]map[string]*svcCount)}
+}
+
+// observe folds one packet's service types into the per-group counters.
+func (s *serviceStats) observe(group string, pkt *packet) {
+	svcs := pkt.services()
+	if len(svcs) == 0 {
+		return
+	}
+	kind := "query"
+	if pkt.msg.Response {
+		kind = "response"
+	}
+	s.mu.Lock()
+	byService, ok := s.counts[group]
+	if !ok {
+		byService = make(map[string]*svcCount)
+		s.counts[group] = byService
+	}
+	for _, svc := range svcs {
+		c, ok := byService[svc]
+		if !ok {
+			c = &svcCount{}
+			byService[svc] = c
+		}
+		if pkt.msg.Response {
+			c.Responses++
+		} else {
+			c.Queries++
+		}
+	}
+	s.mu.Unlock()
+	for _, svc := range svcs {
+		metrics.Inc("mdns_service_packets_total", Labels{"group": group, "service": svc, "kind": kind})
+	}
+}
+
+// serviceReport is one row of the /services breakdown.
+type serviceReport struct {
+	Group            string  `json:"group"`
+	Service          string  `json:"service"`
+	Queries          uint64  `json:"queries"`
+	Responses        uint64  `json:"responses"`
+	QueriesPerHour   float64 `json:"queries_per_hour"`
+	ResponsesPerHour float64 `json:"responses_per_hour"`
+}
+
+// report returns the breakdown sorted by total traffic, busiest first.
+func (s *serviceStats) report() []serviceReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hours := time.Since(s.since).Hours()
+	if hours <= 0 {
+		hours = 1e-9
+	}
+	var out []serviceReport
+	for group, byService := range s.counts {
+		for svc, c := range byService {
+			out = append(out, serviceReport{
+				Group:            group,
+				Service:          svc,
+				Queries:          c.Queries,
+				Responses:        c.Responses,
+				QueriesPerHour:   float64(c.Queries) / hours,
+				ResponsesPerHour: float64(c.Responses) / hours,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Queries+out[i].Responses > out[j].Queries+out[j].Responses
+	})
+	return out
+}
+
+// servicesHandler serves the per-service-type traffic breakdown.
+func (a *apiServer) servicesHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.r.svcStats.report())
+}
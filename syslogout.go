@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/syslog"
+	"os"
+)
+
+// SyslogConfig routes the daemon's log output to syslog. Many router
+// distros centralize logs through syslogd rather than journald, local
+// flash being too small to keep them.
+type SyslogConfig struct {
+	// Enabled turns syslog output on; with no Address the local syslog
+	// socket is used.
+	Enabled bool `yaml:"enabled"`
+	// Network is "udp", "tcp" or "unix"; empty with an empty Address
+	// means the local daemon.
+	Network string `yaml:"network"`
+	Address string `yaml:"address"`
+	// Facility is "daemon" (the default), "user" or "local0".."local7".
+	Facility string `yaml:"facility"`
+	// Tag defaults to "mdns-reflector".
+	Tag string `yaml:"tag"`
+}
+
+var syslogFacilities = map[string]syslog.Priority{
+	"":       syslog.LOG_DAEMON,
+	"daemon": syslog.LOG_DAEMON,
+	"user":   syslog.LOG_USER,
+	"local0": syslog.LOG_LOCAL0,
+	"local1": syslog.LOG_LOCAL1,
+	"local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4,
+	"local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6,
+	"local7": syslog.LOG_LOCAL7,
+}
+
+func (c *SyslogConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if _, ok := syslogFacilities[c.Facility]; !ok {
+		return fmt.Errorf("syslog: unknown facility %q", c.Facility)
+	}
+	switch c.Network {
+	case "", "udp", "tcp", "unix":
+	default:
+		return fmt.Errorf("syslog: unknown network %q", c.Network)
+	}
+	return nil
+}
+
+// setupSyslog redirects the standard logger to syslog (keeping stderr, so
+// foreground runs stay readable). Messages go out at severity info;
+// transition alerts already carry their severity in the text.
+func setupSyslog(cfg *Config) {
+	if !cfg.Syslog.Enabled {
+		return
+	}
+	tag := cfg.Syslog.Tag
+	if tag == "" {
+		tag = "mdns-reflector"
+	}
+	w, err := syslog.Dial(cfg.Syslog.Network, cfg.Syslog.Address, syslogFacilities[cfg.Syslog.Facility]|syslog.LOG_INFO, tag)
+	if err != nil {
+		log.Printf("syslog unavailable: %v", err)
+		return
+	}
+	log.SetFlags(0) // syslog adds its own timestamp
+	log.SetOutput(io.MultiWriter(os.Stderr, w))
+}
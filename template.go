@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule templates reduce duplication in configs with many similar VLAN
+// pairs. A template is a rule body with ${param} placeholders:
+//
+//	rule_templates:
+//	  iot_to_users:
+//	    from: ${src}
+//	    to: [${dst}]
+//	    filter:
+//	      allowed_services: ${services}
+//
+//	rules:
+//	  - template: iot_to_users
+//	    args: {src: iot, dst: users, services: [_airplay._tcp]}
+//
+// A placeholder standing alone is replaced by the argument's YAML value
+// (so lists and maps work); placeholders inside longer strings are
+// interpolated textually.
+
+// expandTemplates rewrites every template-invoking rule into a concrete
+// rule before validation.
+func (c *Config) expandTemplates() error {
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.Template == "" {
+			continue
+		}
+		tmpl, ok := c.Templates[r.Template]
+		if !ok {
+			return fmt.Errorf("rule %d: unknown template %q", i, r.Template)
+		}
+		node, err := substituteNode(&tmpl, r.Args)
+		if err != nil {
+			return fmt.Errorf("rule %d: template %q: %w", i, r.Template, err)
+		}
+		var expanded Rule
+		if err := node.Decode(&expanded); err != nil {
+			return fmt.Errorf("rule %d: template %q: %w", i, r.Template, err)
+		}
+		c.Rules[i] = expanded
+	}
+	return nil
+}
+
+// substituteNode deep-copies a YAML node, replacing ${param} placeholders
+// from args. Unresolved placeholders are an error so typos fail loudly at
+// load time.
+func substituteNode(n *yaml.Node, args map[string]yaml.Node) (*yaml.Node, error) {
+	out := *n
+	if n.Kind == yaml.ScalarNode {
+		val := n.Value
+		if strings.HasPrefix(val, "${") && strings.HasSuffix(val, "}") && strings.Count(val, "${") == 1 {
+			name := val[2 : len(val)-1]
+			arg, ok := args[name]
+			if !ok {
+				return nil, fmt.Errorf("missing argument %q", name)
+			}
+			return &arg, nil
+		}
+		for strings.Contains(val, "${") {
+			start := strings.Index(val, "${")
+			end := strings.Index(val[start:], "}")
+			if end < 0 {
+				break
+			}
+			name := val[start+2 : start+end]
+			arg, ok := args[name]
+			if !ok {
+				return nil, fmt.Errorf("missing argument %q", name)
+			}
+			if arg.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("argument %q is not a scalar but is interpolated into %q", name, n.Value)
+			}
+			val = val[:start] + arg.Value + val[start+end+1:]
+		}
+		out.Value = val
+		return &out, nil
+	}
+	out.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		sub, err := substituteNode(child, args)
+		if err != nil {
+			return nil, err
+		}
+		out.Content[i] = sub
+	}
+	return &out, nil
+}
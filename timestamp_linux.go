@@ -0,0 +1,63 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// EnableRxTimestamps asks the kernel to attach SO_TIMESTAMPNS control
+// messages to received datagrams, so queueing delay between the NIC and
+// the daemon is measurable.
+func (nativeSockOps) EnableRxTimestamps(uc *net.UDPConn) error {
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// ParseOOB extracts the receiving interface index and destination address
+// (IP_PKTINFO), the kernel receive timestamp (SCM_TIMESTAMPNS) and the IP
+// TTL (IP_TTL) from socket control messages. Any value may be absent.
+func (nativeSockOps) ParseOOB(oob []byte) rxMeta {
+	var meta rxMeta
+	cmsgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return meta
+	}
+	for _, cm := range cmsgs {
+		switch {
+		case cm.Header.Level == unix.SOL_IP && cm.Header.Type == unix.IP_PKTINFO:
+			if len(cm.Data) >= 12 {
+				meta.ifindex = int(int32(uint32(cm.Data[0]) | uint32(cm.Data[1])<<8 | uint32(cm.Data[2])<<16 | uint32(cm.Data[3])<<24))
+				// ipi_addr is the packet's destination address.
+				meta.dst = net.IPv4(cm.Data[8], cm.Data[9], cm.Data[10], cm.Data[11])
+			}
+		case cm.Header.Level == unix.SOL_IP && cm.Header.Type == unix.IP_TTL:
+			if len(cm.Data) >= 4 {
+				meta.ttl = int(uint32(cm.Data[0]) | uint32(cm.Data[1])<<8 | uint32(cm.Data[2])<<16 | uint32(cm.Data[3])<<24)
+			}
+		case cm.Header.Level == unix.SOL_SOCKET && cm.Header.Type == unix.SCM_TIMESTAMPNS:
+			if len(cm.Data) >= 16 {
+				var sec, nsec int64
+				for i := 0; i < 8; i++ {
+					sec |= int64(cm.Data[i]) << (8 * i)
+					nsec |= int64(cm.Data[8+i]) << (8 * i)
+				}
+				meta.kstamp = time.Unix(sec, nsec)
+			}
+		}
+	}
+	return meta
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+// EnableRxTimestamps is a no-op on platforms without SO_TIMESTAMPNS.
+func (nativeSockOps) EnableRxTimestamps(*net.UDPConn) error {
+	return nil
+}
+
+// ParseOOB cannot decode control messages on this platform; the caller
+// falls back to the ipv4 package's interface resolution.
+func (nativeSockOps) ParseOOB([]byte) rxMeta {
+	return rxMeta{}
+}
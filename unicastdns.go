@@ -0,0 +1,211 @@
+package main
+
+import (
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// UnicastFallbackConfig rescues broken clients that send .local queries to
+// their unicast resolver: an optional UDP listener accepts such queries,
+// asks the question over mDNS on the configured group, and relays the
+// answer back unicast.
+type UnicastFallbackConfig struct {
+	// Listen is the UDP address, e.g. ":53" or "127.0.0.1:5355". Empty
+	// disables the listener.
+	Listen string `yaml:"listen"`
+	// Group is where the mDNS query is issued.
+	Group string `yaml:"group"`
+	// Timeout in seconds to wait for an mDNS answer; defaults to 3.
+	Timeout int `yaml:"timeout"`
+}
+
+// unicastBridge is the runtime state of the fallback listener.
+type unicastBridge struct {
+	r       *Reflector
+	conn    *net.UDPConn
+	group   *Group
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[string][]*pendingUnicast // question key -> waiting clients
+}
+
+type pendingUnicast struct {
+	client   *net.UDPAddr
+	id       uint16
+	question dns.Question
+	deadline time.Time
+}
+
+// questionKey normalizes a question for matching answers against it.
+func questionKey(name string, qtype uint16) string {
+	return strings.ToLower(dns.Fqdn(name)) + "/" + dns.TypeToString[qtype]
+}
+
+// startUnicastFallback launches the listener if configured.
+func startUnicastFallback(cfg *Config, r *Reflector) *unicastBridge {
+	if cfg.UnicastFallback.Listen == "" {
+		return nil
+	}
+	g := cfg.group(cfg.UnicastFallback.Group)
+	if g == nil {
+		log.Printf("unicast_fallback: unknown group %q, listener disabled", cfg.UnicastFallback.Group)
+		return nil
+	}
+	addr, err := net.ResolveUDPAddr("udp4", cfg.UnicastFallback.Listen)
+	if err != nil {
+		log.Printf("unicast_fallback: bad listen address: %v", err)
+		return nil
+	}
+	conn, err := net.ListenUDP("udp4", addr)
+	if err != nil {
+		log.Printf("unicast_fallback: %v", err)
+		return nil
+	}
+	b := &unicastBridge{
+		r:       r,
+		conn:    conn,
+		group:   g,
+		timeout: time.Duration(cfg.UnicastFallback.Timeout) * time.Second,
+		pending: make(map[string][]*pendingUnicast),
+	}
+	if b.timeout <= 0 {
+		b.timeout = 3 * time.Second
+	}
+	go b.serve()
+	go b.expire()
+	log.Printf("unicast .local fallback listening on %s, resolving via group %q", cfg.UnicastFallback.Listen, g.Name)
+	return b
+}
+
+func (b *unicastBridge) serve() {
+	buf := make([]byte, 4096)
+	for {
+		n, client, err := b.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		query := new(dns.Msg)
+		if err := query.Unpack(buf[:n]); err != nil || len(query.Question) == 0 {
+			continue
+		}
+		q := query.Question[0]
+		if !strings.HasSuffix(strings.ToLower(q.Name), ".local.") {
+			refused := new(dns.Msg)
+			refused.SetRcode(query, dns.RcodeRefused)
+			b.reply(client, refused)
+			continue
+		}
+		b.mu.Lock()
+		key := questionKey(q.Name, q.Qtype)
+		b.pending[key] = append(b.pending[key], &pendingUnicast{
+			client:   client,
+			id:       query.Id,
+			question: q,
+			deadline: time.Now().Add(b.timeout),
+		})
+		b.mu.Unlock()
+
+		probe := new(dns.Msg)
+		probe.Question = append(probe.Question, dns.Question{Name: q.Name, Qtype: q.Qtype, Qclass: dns.ClassINET})
+		if wire, err := probe.Pack(); err == nil {
+			for _, name := range b.group.Interfaces {
+				b.r.send(wire, name)
+			}
+		}
+		metrics.Inc("mdns_unicast_fallback_queries_total", nil)
+	}
+}
+
+// observe matches mDNS responses against pending unicast queries.
+func (b *unicastBridge) observe(pkt *packet) {
+	if !pkt.msg.Response {
+		return
+	}
+	records := append(append([]dns.RR{}, pkt.msg.Answer...), pkt.msg.Extra...)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, rr := range records {
+		h := rr.Header()
+		key := questionKey(h.Name, h.Rrtype)
+		waiters := b.pending[key]
+		if len(waiters) == 0 {
+			continue
+		}
+		delete(b.pending, key)
+		for _, w := range waiters {
+			resp := new(dns.Msg)
+			resp.Id = w.id
+			resp.Response = true
+			resp.Question = []dns.Question{w.question}
+			for _, cand := range records {
+				ch := cand.Header()
+				if strings.EqualFold(ch.Name, h.Name) && ch.Rrtype == w.question.Qtype {
+					// The cache-flush bit is not meaningful in unicast DNS.
+					clean := dns.Copy(cand)
+					clean.Header().Class = dns.ClassINET
+					resp.Answer = append(resp.Answer, clean)
+				}
+			}
+			go b.reply(w.client, resp)
+		}
+	}
+}
+
+// expire answers timed-out queries with SERVFAIL so clients fail fast.
+func (b *unicastBridge) expire() {
+	for range time.Tick(time.Second) {
+		now := time.Now()
+		b.mu.Lock()
+		for key, waiters := range b.pending {
+			var alive []*pendingUnicast
+			for _, w := range waiters {
+				if now.After(w.deadline) {
+					fail := new(dns.Msg)
+					fail.Id = w.id
+					fail.Response = true
+					fail.Rcode = dns.RcodeServerFailure
+					fail.Question = []dns.Question{w.question}
+					go b.reply(w.client, fail)
+					continue
+				}
+				alive = append(alive, w)
+			}
+			if len(alive) == 0 {
+				delete(b.pending, key)
+			} else {
+				b.pending[key] = alive
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+// flush answers every pending question with SERVFAIL and clears the
+// table.
+func (b *unicastBridge) flush() {
+	b.mu.Lock()
+	for _, waiters := range b.pending {
+		for _, w := range waiters {
+			fail := new(dns.Msg)
+			fail.Id = w.id
+			fail.Response = true
+			fail.Rcode = dns.RcodeServerFailure
+			fail.Question = []dns.Question{w.question}
+			go b.reply(w.client, fail)
+		}
+	}
+	b.pending = make(map[string][]*pendingUnicast)
+	b.mu.Unlock()
+}
+
+func (b *unicastBridge) reply(client *net.UDPAddr, msg *dns.Msg) {
+	if wire, err := msg.Pack(); err == nil {
+		b.conn.WriteToUDP(wire, client)
+	}
+}
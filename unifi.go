@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UniFi controller integration. The networks that need a reflector —
+// many VLANs, one router — very often run UniFi, and the controller
+// already knows every client's admin-assigned name, access point and
+// network. Polling its API lets the inventory and conformance warnings
+// show "Kitchen HomePod on Office-AP (iot)" instead of a bare MAC.
+// Controller data fills gaps only: a label assigned through /names
+// always wins.
+
+// UniFiConfig points at a controller.
+type UniFiConfig struct {
+	// URL is the controller base, e.g. "https://10.0.1.1:8443" or a
+	// UDM's "https://10.0.1.1" (detected by the login response).
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Site is the controller site name; default "default".
+	Site string `yaml:"site"`
+	// IntervalSeconds is the poll period; default 300.
+	IntervalSeconds int `yaml:"interval_seconds"`
+	// InsecureTLS skips certificate verification; controllers ship
+	// self-signed certificates.
+	InsecureTLS bool `yaml:"insecure_tls"`
+}
+
+// validate checks the block when enabled.
+func (c *UniFiConfig) validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	if c.Username == "" || c.Password == "" {
+		return fmt.Errorf("unifi: username and password are required")
+	}
+	if c.Site == "" {
+		c.Site = "default"
+	}
+	if c.IntervalSeconds <= 0 {
+		c.IntervalSeconds = 300
+	}
+	return nil
+}
+
+// unifiClient is what the directory keeps per client MAC.
+type unifiClient struct {
+	Label   string
+	AP      string
+	Network string
+}
+
+// unifiDirectory caches the controller's client table.
+type unifiDirectory struct {
+	mu    sync.Mutex
+	byMAC map[string]unifiClient
+}
+
+var unifiDir = &unifiDirectory{byMAC: make(map[string]unifiClient)}
+
+// lookup returns the controller's view of a MAC, or zero values.
+func (d *unifiDirectory) lookup(mac string) unifiClient {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.byMAC[strings.ToLower(mac)]
+}
+
+// unifiPoller holds the session with one controller.
+type unifiPoller struct {
+	cfg    *UniFiConfig
+	client *http.Client
+	// proxied is set when the controller answers under the UDM-style
+	// /proxy/network prefix.
+	proxied bool
+}
+
+// startUniFi begins polling the controller when configured.
+func startUniFi(cfg *Config) {
+	if cfg.UniFi.URL == "" {
+		return
+	}
+	jar, _ := cookiejar.New(nil)
+	p := &unifiPoller{cfg: &cfg.UniFi, client: &http.Client{
+		Timeout: 15 * time.Second,
+		Jar:     jar,
+	}}
+	if cfg.UniFi.InsecureTLS {
+		p.client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	go p.run()
+	log.Printf("unifi: polling %s every %ds", cfg.UniFi.URL, cfg.UniFi.IntervalSeconds)
+}
+
+func (p *unifiPoller) run() {
+	for {
+		if err := p.poll(); err != nil {
+			log.Printf("unifi: %v", err)
+			metrics.Inc("mdns_unifi_poll_errors_total", nil)
+		}
+		time.Sleep(time.Duration(p.cfg.IntervalSeconds) * time.Second)
+	}
+}
+
+// login opens a controller session, detecting the UDM path prefix.
+func (p *unifiPoller) login() error {
+	body := fmt.Sprintf(`{"username":%q,"password":%q}`, p.cfg.Username, p.cfg.Password)
+	for _, attempt := range []struct {
+		path    string
+		proxied bool
+	}{
+		{"/api/login", false},
+		{"/api/auth/login", true},
+	} {
+		resp, err := p.client.Post(p.cfg.URL+attempt.path, "application/json", strings.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			p.proxied = attempt.proxied
+			return nil
+		}
+	}
+	return fmt.Errorf("login to %s failed", p.cfg.URL)
+}
+
+// poll fetches the active client list and swaps the directory.
+func (p *unifiPoller) poll() error {
+	clients, err := p.fetchClients()
+	if err != nil {
+		// The session cookie expires; one re-login per poll is enough.
+		if err = p.login(); err != nil {
+			return err
+		}
+		if clients, err = p.fetchClients(); err != nil {
+			return err
+		}
+	}
+	byMAC := make(map[string]unifiClient, len(clients))
+	for _, c := range clients {
+		label := c.Name
+		if label == "" {
+			label = c.Hostname
+		}
+		byMAC[strings.ToLower(c.MAC)] = unifiClient{
+			Label:   label,
+			AP:      c.APMAC,
+			Network: c.Network,
+		}
+	}
+	unifiDir.mu.Lock()
+	unifiDir.byMAC = byMAC
+	unifiDir.mu.Unlock()
+	metrics.Set("mdns_unifi_clients", nil, float64(len(byMAC)))
+	return nil
+}
+
+// unifiSta is the subset of the controller's client record we read.
+type unifiSta struct {
+	MAC      string `json:"mac"`
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+	APMAC    string `json:"ap_mac"`
+	Network  string `json:"network"`
+}
+
+func (p *unifiPoller) fetchClients() ([]unifiSta, error) {
+	path := fmt.Sprintf("/api/s/%s/stat/sta", p.cfg.Site)
+	if p.proxied {
+		path = "/proxy/network" + path
+	}
+	resp, err := p.client.Get(p.cfg.URL + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	var parsed struct {
+		Data []unifiSta `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return parsed.Data, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// AnswerValidationConfig checks that address records inside a response are
+// plausibly the sender's own: the record must match the packet's source IP
+// or fall within a network of the interface the packet arrived on. A
+// device claiming someone else's addresses is usually misconfigured, and
+// occasionally hostile.
+//
+// Mode "flag" logs and counts violations but still reflects; "drop"
+// discards the response. Default is "off".
+type AnswerValidationConfig struct {
+	Mode string `yaml:"mode"`
+}
+
+func (a *AnswerValidationConfig) compile() error {
+	switch a.Mode {
+	case "", "off", "flag", "drop":
+		return nil
+	}
+	return fmt.Errorf("answer_validation: mode must be off, flag or drop, got %q", a.Mode)
+}
+
+// validateAnswerSource reports whether the response should be forwarded.
+func (r *Reflector) validateAnswerSource(pkt *packet, srcIface string) bool {
+	mode := r.config().AnswerValidation.Mode
+	if mode == "" || mode == "off" || !pkt.msg.Response {
+		return true
+	}
+	var nets []*net.IPNet
+	if ifi := r.iface(srcIface); ifi != nil {
+		if addrs, err := ifi.Addrs(); err == nil {
+			for _, addr := range addrs {
+				if ipnet, ok := addr.(*net.IPNet); ok {
+					nets = append(nets, ipnet)
+				}
+			}
+		}
+	}
+	var bad []string
+	for _, rr := range append(append([]dns.RR{}, pkt.msg.Answer...), pkt.msg.Extra...) {
+		var ip net.IP
+		switch rec := rr.(type) {
+		case *dns.A:
+			ip = rec.A
+		case *dns.AAAA:
+			ip = rec.AAAA
+		default:
+			continue
+		}
+		if ip.Equal(pkt.src.IP) || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		plausible := false
+		for _, n := range nets {
+			if n.Contains(ip) {
+				plausible = true
+				break
+			}
+		}
+		if !plausible {
+			bad = append(bad, ip.String())
+		}
+	}
+	if len(bad) == 0 {
+		return true
+	}
+	metrics.Inc("mdns_answer_validation_total", Labels{"mode": mode, "iface": srcIface})
+	r.events.publish(Event{
+		Type:    "answer_validation",
+		Iface:   srcIface,
+		SrcIP:   pkt.src.IP.String(),
+		Action:  mode,
+		Summary: fmt.Sprintf("response claims implausible addresses %v", bad),
+	})
+	if mode == "drop" {
+		return false
+	}
+	return true
+}
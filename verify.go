@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// Connectivity verifier. Reflection makes a service discoverable on
+// another VLAN; the firewall decides whether it is reachable, and the
+// two disagreeing is this tool's most common support question. The
+// verifier periodically probes each advertised TCP endpoint from the
+// inventory and marks the ones that answer discovery but refuse
+// connections, so "discoverable but unreachable" shows up in /inventory
+// and on the event bus instead of in a user's broken AirPlay session.
+
+// VerifierConfig tunes the reachability probes.
+type VerifierConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// IntervalSeconds is the probe cycle period; default 300.
+	IntervalSeconds int `yaml:"interval_seconds"`
+	// TimeoutMS is the per-connection timeout; default 2000.
+	TimeoutMS int `yaml:"timeout_ms"`
+}
+
+// validate applies defaults.
+func (c *VerifierConfig) validate() error {
+	if c.IntervalSeconds <= 0 {
+		c.IntervalSeconds = 300
+	}
+	if c.TimeoutMS <= 0 {
+		c.TimeoutMS = 2000
+	}
+	return nil
+}
+
+// verifierMaxProbes bounds one cycle on very large inventories.
+const verifierMaxProbes = 256
+
+// startVerifier launches the probe loop when enabled.
+func startVerifier(cfg *Config, r *Reflector) {
+	if !cfg.Verifier.Enabled {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(time.Duration(r.config().Verifier.IntervalSeconds) * time.Second)
+			r.verifyInventory()
+		}
+	}()
+	log.Printf("verifier: probing advertised TCP services every %ds", cfg.Verifier.IntervalSeconds)
+}
+
+// verifyInventory probes every TCP service instance with an address and
+// port, updating its reachability flag.
+func (r *Reflector) verifyInventory() {
+	timeout := time.Duration(r.config().Verifier.TimeoutMS) * time.Millisecond
+	probed := 0
+	unreachable := 0
+	for _, e := range r.inv.snapshot() {
+		if probed >= verifierMaxProbes {
+			break
+		}
+		// UDP services don't complete handshakes; only TCP endpoints
+		// give a yes/no answer.
+		if !strings.HasSuffix(e.Service, "._tcp") || e.Port == 0 || len(e.IPs) == 0 {
+			continue
+		}
+		probed++
+		ok := false
+		for _, ip := range e.IPs {
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, fmt.Sprint(e.Port)), timeout)
+			if err == nil {
+				conn.Close()
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			unreachable++
+		}
+		if changed := r.inv.setUnreachable(e.Instance, !ok); changed {
+			state := "reachable"
+			if !ok {
+				state = "unreachable"
+			}
+			log.Printf("verifier: %s (%s:%d) is %s", e.Instance, e.IPs[0], e.Port, state)
+			r.events.publish(Event{
+				Type:    "reachability",
+				Iface:   e.Iface,
+				SrcIP:   e.SrcIP,
+				Summary: fmt.Sprintf("%s on port %d is %s", e.Instance, e.Port, state),
+			})
+		}
+	}
+	metrics.Set("mdns_unreachable_services", nil, float64(unreachable))
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// BindToDevice attaches the socket to a VRF (or any other) device with
+// SO_BINDTODEVICE, scoping its receive and send paths to that device's
+// routing domain.
+func (nativeSockOps) BindToDevice(uc *net.UDPConn, device string) error {
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		serr = unix.BindToDevice(int(fd), device)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// BindToDevice requires SO_BINDTODEVICE; VRFs are a Linux concept.
+func (nativeSockOps) BindToDevice(uc *net.UDPConn, device string) error {
+	return fmt.Errorf("vrf binding is only supported on linux")
+}